@@ -1,15 +1,29 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/porter-dev/switchboard/internal/query"
+	"github.com/porter-dev/switchboard/pkg/drivers"
 	"github.com/porter-dev/switchboard/pkg/drivers/helm"
+	"github.com/porter-dev/switchboard/pkg/drivers/helm/loader"
 	"github.com/porter-dev/switchboard/pkg/drivers/kubernetes"
 	"github.com/porter-dev/switchboard/pkg/drivers/terraform"
+	"github.com/porter-dev/switchboard/pkg/encryption"
 	"github.com/porter-dev/switchboard/pkg/parser"
+	"github.com/porter-dev/switchboard/pkg/secrets"
+	"github.com/porter-dev/switchboard/pkg/state"
 	"github.com/porter-dev/switchboard/pkg/types"
 	"github.com/porter-dev/switchboard/pkg/worker"
 	"github.com/rs/zerolog"
@@ -18,6 +32,28 @@ import (
 
 var Version string = "dev"
 
+var (
+	statePath       string
+	stateBackend    string
+	stateNamespace  string
+	stateName       string
+	stateKubeconfig string
+	stateContext    string
+
+	secretsKubeconfig string
+	secretsContext    string
+
+	ageKeyFile string
+
+	cacheDir      string
+	chartIndexTTL time.Duration
+
+	prune       bool
+	atomic      bool
+	autoApprove bool
+	parallelism int
+)
+
 var rootCmd = &cobra.Command{
 	Use: "switchboard",
 }
@@ -35,7 +71,76 @@ var applyCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		logger := zerolog.New(zerolog.NewConsoleWriter())
 
-		err := apply(args, &logger)
+		err := apply(cmd.Context(), args, &logger)
+
+		if err != nil {
+			logger.Err(err).Send()
+			os.Exit(1)
+		}
+	},
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan [file]",
+	Short: "Preview the changes that apply would make, without modifying any targets",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := zerolog.New(zerolog.NewConsoleWriter())
+
+		err := plan(cmd.Context(), args, &logger)
+
+		if err != nil {
+			logger.Err(err).Send()
+			os.Exit(1)
+		}
+	},
+}
+
+var destroyCmd = &cobra.Command{
+	Use:   "destroy [file]",
+	Short: "Delete every resource in the resource group, in reverse dependency order",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := zerolog.New(zerolog.NewConsoleWriter())
+
+		err := destroy(cmd.Context(), args, &logger)
+
+		if err != nil {
+			logger.Err(err).Send()
+			os.Exit(1)
+		}
+	},
+}
+
+var outputCmd = &cobra.Command{
+	Use:   "output [resource]",
+	Short: "Print the output of applied resources from the state, without re-applying",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := zerolog.New(zerolog.NewConsoleWriter())
+
+		err := output(cmd.Context(), args, &logger)
+
+		if err != nil {
+			logger.Err(err).Send()
+			os.Exit(1)
+		}
+	},
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the cache of downloaded charts and modules",
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every cached chart, repository index and git module",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger := zerolog.New(zerolog.NewConsoleWriter())
+
+		err := clearCache()
 
 		if err != nil {
 			logger.Err(err).Send()
@@ -45,44 +150,359 @@ var applyCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.AddCommand(applyCmd, versionCmd)
+	rootCmd.PersistentFlags().StringVar(&statePath, "state", "switchboard.state.json", "path to the state file, when using the local state backend")
+	rootCmd.PersistentFlags().StringVar(&stateBackend, "state-backend", "local", "the state backend to use: one of local, secret, or configmap")
+	rootCmd.PersistentFlags().StringVar(&stateNamespace, "state-namespace", "default", "the namespace of the state secret or configmap")
+	rootCmd.PersistentFlags().StringVar(&stateName, "state-name", "switchboard-state", "the name of the state secret or configmap")
+	rootCmd.PersistentFlags().StringVar(&stateKubeconfig, "state-kubeconfig", "", "path to the kubeconfig used by the secret and configmap state backends")
+	rootCmd.PersistentFlags().StringVar(&stateContext, "state-context", "", "the kubeconfig context used by the secret and configmap state backends")
+
+	rootCmd.PersistentFlags().StringVar(&secretsKubeconfig, "secrets-kubeconfig", "", "path to the kubeconfig used to read { secret:k8s.namespace/name/key } references")
+	rootCmd.PersistentFlags().StringVar(&secretsContext, "secrets-context", "", "the kubeconfig context used to read { secret:k8s.namespace/name/key } references")
+
+	rootCmd.PersistentFlags().StringVar(&ageKeyFile, "age-key-file", "", "path to the age key file used to decrypt encrypted resource groups; defaults to $SOPS_AGE_KEY_FILE, or the default SOPS key file if it exists")
+
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", getDefaultCacheDir(), "the directory where downloaded charts and modules are cached; caching is disabled if empty")
+	rootCmd.PersistentFlags().DurationVar(&chartIndexTTL, "chart-index-ttl", loader.DefaultIndexTTL, "the duration that cached chart repository indexes are used for before they are downloaded again")
+
+	applyCmd.Flags().BoolVar(&prune, "prune", false, "delete resources which were removed from the resource group since the last apply")
+	applyCmd.Flags().BoolVar(&atomic, "atomic", false, "roll back every applied resource if any resource fails to apply")
+	applyCmd.Flags().BoolVarP(&autoApprove, "yes", "y", false, "skip confirmation before pruning resources")
+
+	for _, cmd := range []*cobra.Command{applyCmd, planCmd, destroyCmd} {
+		cmd.Flags().IntVar(&parallelism, "parallelism", 0, "the maximum number of resources to operate on concurrently; unlimited if 0")
+	}
+
+	cacheCmd.AddCommand(cacheClearCmd)
+
+	rootCmd.AddCommand(applyCmd, planCmd, destroyCmd, outputCmd, cacheCmd, versionCmd)
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	// cancel in-flight operations on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		color.New(color.FgRed).Println(err)
 		os.Exit(1)
 	}
 }
 
-func apply(args []string, logger *zerolog.Logger) error {
-	filepath := args[0]
+func apply(ctx context.Context, args []string, logger *zerolog.Logger) error {
+	resGroup, basePath, err := readResourceGroup(args[0])
 
-	fileBytes, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	worker, err := newWorker(basePath)
+
+	if err != nil {
+		return err
+	}
+
+	opts := &types.ApplyOpts{
+		BasePath:       basePath,
+		Prune:          prune,
+		Atomic:         atomic,
+		MaxParallelism: parallelism,
+		CacheDir:       cacheDir,
+		ChartIndexTTL:  chartIndexTTL,
+	}
+
+	if !autoApprove {
+		opts.ConfirmPrune = confirmPrune
+	}
+
+	return worker.Apply(ctx, resGroup, opts)
+}
+
+// confirmPrune prints the resources that will be pruned and prompts for confirmation
+func confirmPrune(orphans []*state.ResourceState) bool {
+	color.New(color.FgRed).Println("The following resources were removed from the resource group and will be deleted:")
+
+	for _, orphan := range orphans {
+		fmt.Printf("    %s (%s)\n", orphan.Name, orphan.Driver)
+	}
+
+	fmt.Print("Do you want to continue? Only 'yes' will be accepted: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	answer, _ := reader.ReadString('\n')
+
+	return strings.TrimSpace(answer) == "yes"
+}
+
+func destroy(ctx context.Context, args []string, logger *zerolog.Logger) error {
+	resGroup, basePath, err := readResourceGroup(args[0])
+
+	if err != nil {
+		return err
+	}
+
+	worker, err := newWorker(basePath)
+
+	if err != nil {
+		return err
+	}
+
+	return worker.Destroy(ctx, resGroup, &types.ApplyOpts{
+		BasePath:       basePath,
+		MaxParallelism: parallelism,
+		CacheDir:       cacheDir,
+		ChartIndexTTL:  chartIndexTTL,
+	})
+}
+
+func plan(ctx context.Context, args []string, logger *zerolog.Logger) error {
+	resGroup, basePath, err := readResourceGroup(args[0])
 
 	if err != nil {
 		return err
 	}
 
-	resGroup, err := parser.ParseRawBytes(fileBytes)
+	worker, err := newWorker(basePath)
 
 	if err != nil {
 		return err
 	}
 
+	plans, planErr := worker.Plan(ctx, resGroup, &types.ApplyOpts{
+		BasePath:       basePath,
+		MaxParallelism: parallelism,
+		CacheDir:       cacheDir,
+		ChartIndexTTL:  chartIndexTTL,
+	})
+
+	printPlans(resGroup, plans)
+
+	return planErr
+}
+
+// printPlans prints a per-resource summary of the plans, in the order that resources
+// are declared in the resource group
+func printPlans(resGroup *types.ResourceGroup, plans map[string]*drivers.Plan) {
+	counts := make(map[drivers.PlanAction]int)
+
+	for _, resource := range resGroup.Resources {
+		plan, ok := plans[resource.Name]
+
+		if !ok {
+			continue
+		}
+
+		counts[plan.Action]++
+
+		var c *color.Color
+
+		switch plan.Action {
+		case drivers.PlanActionCreate:
+			c = color.New(color.FgGreen)
+		case drivers.PlanActionUpdate:
+			c = color.New(color.FgYellow)
+		default:
+			c = color.New(color.Faint)
+		}
+
+		c.Printf("%s: %s\n", resource.Name, plan.Action)
+
+		if plan.Diff != "" {
+			for _, line := range strings.Split(strings.TrimRight(plan.Diff, "\n"), "\n") {
+				fmt.Printf("    %s\n", line)
+			}
+		}
+	}
+
+	fmt.Printf(
+		"\nPlan: %d to create, %d to update, %d unchanged.\n",
+		counts[drivers.PlanActionCreate],
+		counts[drivers.PlanActionUpdate],
+		counts[drivers.PlanActionNoop],
+	)
+}
+
+func readResourceGroup(filepath string) (*types.ResourceGroup, string, error) {
+	fileBytes, err := ioutil.ReadFile(filepath)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	decrypter, err := getDecrypter()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	resGroup, err := parser.ParseEncryptedBytes(fileBytes, decrypter)
+
+	if err != nil {
+		return nil, "", err
+	}
+
 	basePath, err := os.Getwd()
 
+	if err != nil {
+		return nil, "", err
+	}
+
+	return resGroup, basePath, nil
+}
+
+func output(ctx context.Context, args []string, logger *zerolog.Logger) error {
+	backend, err := getStateBackend()
+
+	if err != nil {
+		return err
+	}
+
+	st, err := backend.Load(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var res interface{}
+
+	if len(args) == 1 {
+		resourceState, ok := st.Resources[args[0]]
+
+		if !ok {
+			return fmt.Errorf("resource %s not found in state", args[0])
+		}
+
+		res = getStateOutput(resourceState)
+	} else {
+		allOutputs := make(map[string]interface{})
+
+		for name, resourceState := range st.Resources {
+			allOutputs[name] = getStateOutput(resourceState)
+		}
+
+		res = allOutputs
+	}
+
+	outputBytes, err := json.MarshalIndent(res, "", "  ")
+
 	if err != nil {
 		return err
 	}
 
+	fmt.Println(string(outputBytes))
+
+	return nil
+}
+
+// getStateOutput returns the output of a resource with its sensitive values redacted.
+// Outputs are redacted before they are saved, but states written by older versions
+// contain the sensitive values alongside their mask.
+func getStateOutput(resourceState *state.ResourceState) interface{} {
+	return query.Redact(resourceState.Output, resourceState.OutputMask)
+}
+
+// getDecrypter loads the age key file, using the same default locations as SOPS. If no key
+// file was set and the default key file does not exist, a nil decrypter is returned, which
+// can only read resource groups without encrypted values.
+func getDecrypter() (*encryption.Decrypter, error) {
+	keyFile := ageKeyFile
+
+	if keyFile == "" {
+		keyFile = os.Getenv("SOPS_AGE_KEY_FILE")
+	}
+
+	if keyFile == "" {
+		userConfigDir, err := os.UserConfigDir()
+
+		if err != nil {
+			return nil, nil
+		}
+
+		keyFile = filepath.Join(userConfigDir, "sops", "age", "keys.txt")
+
+		if _, err := os.Stat(keyFile); err != nil {
+			return nil, nil
+		}
+	}
+
+	return encryption.LoadKeyFile(keyFile)
+}
+
+// getDefaultCacheDir returns the switchboard directory inside the user's cache directory,
+// or an empty string if the user has no cache directory
+func getDefaultCacheDir() string {
+	userCacheDir, err := os.UserCacheDir()
+
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(userCacheDir, "switchboard")
+}
+
+func clearCache() error {
+	if cacheDir == "" {
+		return fmt.Errorf("no cache directory is set")
+	}
+
+	err := loader.ClearCache(cacheDir)
+
+	if err != nil {
+		return err
+	}
+
+	err = terraform.ClearCache(cacheDir)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cleared cache in %s\n", cacheDir)
+
+	return nil
+}
+
+func newWorker(basePath string) (*worker.Worker, error) {
 	worker := worker.NewWorker()
 	worker.RegisterDriver("helm", helm.NewHelmDriver)
 	worker.RegisterDriver("kubernetes", kubernetes.NewKubernetesDriver)
 	worker.RegisterDriver("terraform", terraform.NewTerraformDriver)
 	worker.SetDefaultDriver("helm")
 
-	return worker.Apply(resGroup, &types.ApplyOpts{
-		BasePath: basePath,
+	worker.RegisterSecretProvider("env", &secrets.EnvProvider{})
+	worker.RegisterSecretProvider("file", &secrets.FileProvider{BaseDir: basePath})
+	worker.RegisterSecretProvider("k8s", &secrets.KubernetesProvider{
+		Kubeconfig: secretsKubeconfig,
+		Context:    secretsContext,
 	})
+
+	backend, err := getStateBackend()
+
+	if err != nil {
+		return nil, err
+	}
+
+	worker.SetStateBackend(backend)
+
+	return worker, nil
+}
+
+func getStateBackend() (state.Backend, error) {
+	if stateBackend == "local" {
+		return state.NewLocalBackend(statePath), nil
+	}
+
+	newBackend, ok := state.KubernetesBackendMap[stateBackend]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown state backend %s", stateBackend)
+	}
+
+	agent, err := kubernetes.GetAgentFromHost(stateKubeconfig, stateContext, stateNamespace)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not get kube client for state backend: %v", err)
+	}
+
+	return newBackend(agent.Clientset.CoreV1(), stateNamespace, stateName), nil
 }
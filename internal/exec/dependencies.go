@@ -33,10 +33,17 @@ func (r *DependencyResolver) Resolve() error {
 		r.graph[resource.Name] = append(r.graph[resource.Name], resource.Dependencies...)
 	}
 
-	err := r.depResolve(r.resources[0].Name)
+	// resolve from every resource, since the graph may not be connected
+	for _, resource := range r.resources {
+		if _, ok := r.resolved[resource.Name]; ok {
+			continue
+		}
 
-	if err != nil {
-		return err
+		err := r.depResolve(resource.Name)
+
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -1,16 +1,26 @@
 package exec
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/porter-dev/switchboard/pkg/models"
 )
 
-// TODO: this exec func should probably accept channels or something
-type ExecFunc func(resource *models.Resource) error
+// ExecFunc executes a single resource. Implementations should return promptly once
+// the context is cancelled.
+type ExecFunc func(ctx context.Context, resource *models.Resource) error
 
+// ErrCancelled is returned for nodes which were not executed because execution was
+// cancelled, or because one of their dependencies was cancelled.
+var ErrCancelled = errors.New("cancelled")
+
+// ExecNode is a node in the execution graph. Its status fields are safe to read and
+// write from multiple goroutines.
 type ExecNode struct {
+	mu             sync.RWMutex
 	isExecFinished bool
 	isExecStarted  bool
 	execError      error
@@ -19,27 +29,51 @@ type ExecNode struct {
 }
 
 func (e *ExecNode) IsFinished() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.isExecFinished
 }
 
 func (e *ExecNode) SetFinished() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	e.isExecFinished = true
 }
 
 func (e *ExecNode) IsStarted() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.isExecStarted
 }
 
 func (e *ExecNode) SetStarted() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	e.isExecStarted = true
 }
 
 func (e *ExecNode) SetFinishedWithError(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	e.isExecFinished = true
 	e.execError = err
 }
 
+// IsCancelled returns true if the node was not executed, or did not complete, because
+// execution was cancelled.
+func (e *ExecNode) IsCancelled() bool {
+	return isCancellation(e.ExecError())
+}
+
 func (e *ExecNode) ExecError() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.execError
 }
 
@@ -47,6 +81,10 @@ func (e *ExecNode) ResourceName() string {
 	return e.resource.Name
 }
 
+func (e *ExecNode) Resource() *models.Resource {
+	return e.resource
+}
+
 func (e *ExecNode) ShouldStart() bool {
 	// if the exec has started or finished, return false
 	if e.IsStarted() || e.IsFinished() {
@@ -90,56 +128,160 @@ func GetExecNodes(group *models.ResourceGroup) ([]*ExecNode, error) {
 	return res, nil
 }
 
-// Execute simply calls exec on nodes in parallel, in batches. This could be much more
-// efficient.
-func Execute(nodes []*ExecNode, execFunc ExecFunc) {
-	for {
-		var wg sync.WaitGroup
+// GetReverseExecNodes returns exec nodes with the dependency graph reversed, so that
+// a resource is only executed after every resource that depends on it. This is
+// used when deleting resources.
+func GetReverseExecNodes(group *models.ResourceGroup) ([]*ExecNode, error) {
+	resourceMap := make(map[string]*ExecNode)
+
+	for _, resource := range group.Resources {
+		resourceMap[resource.Name] = &ExecNode{
+			resource: resource,
+			parents:  make([]*ExecNode, 0),
+		}
+	}
+
+	res := make([]*ExecNode, 0)
+
+	for _, execNode := range resourceMap {
+		for _, dependency := range execNode.resource.Dependencies {
+			depNode, ok := resourceMap[dependency]
 
-		// get the list of nodes which are ready to execute, and execute those nodes
-		for _, node := range nodes {
-			nodeP := node
-			if nodeP.ShouldStart() {
-				wg.Add(1)
+			if !ok {
+				return nil, fmt.Errorf("no such resource as: '%s'", dependency)
+			}
 
-				go func() {
-					defer wg.Done()
+			depNode.parents = append(depNode.parents, execNode)
+		}
 
-					nodeP.SetStarted()
+		res = append(res, execNode)
+	}
 
-					for _, parentNode := range nodeP.parents {
-						if parentNode.ExecError() != nil {
-							nodeP.SetFinishedWithError(fmt.Errorf("dependency '%s' failed", parentNode.resource.Name))
-							return
-						}
-					}
+	return res, nil
+}
 
-					err := execFunc(nodeP.resource)
+type ExecuteOpts struct {
+	// MaxParallelism is the maximum number of nodes which execute concurrently. If
+	// it is less than 1, the number of concurrent nodes is not limited.
+	MaxParallelism int
+}
 
-					if err != nil {
-						nodeP.SetFinishedWithError(err)
-						return
-					}
+// Execute calls exec on nodes in parallel. Each node is started as soon as all of its
+// parents have finished, and nodes whose parents failed are finished with an error
+// without being executed. Once the context is cancelled, nodes which have not
+// started are finished with ErrCancelled.
+func Execute(ctx context.Context, nodes []*ExecNode, execFunc ExecFunc, opts *ExecuteOpts) {
+	if len(nodes) == 0 {
+		return
+	}
 
-					nodeP.SetFinished()
-				}()
+	if opts == nil {
+		opts = &ExecuteOpts{}
+	}
+
+	// compute the children of each node and the number of unfinished parents, only
+	// counting parents which are part of this execution
+	inGraph := make(map[*ExecNode]bool)
+
+	for _, node := range nodes {
+		inGraph[node] = true
+	}
+
+	children := make(map[*ExecNode][]*ExecNode)
+	remainingParents := make(map[*ExecNode]int)
+
+	for _, node := range nodes {
+		for _, parent := range node.parents {
+			if inGraph[parent] {
+				children[parent] = append(children[parent], node)
+				remainingParents[node]++
 			}
 		}
+	}
+
+	var sem chan struct{}
+
+	if opts.MaxParallelism > 0 {
+		sem = make(chan struct{}, opts.MaxParallelism)
+	}
 
-		wg.Wait()
+	finished := make(chan *ExecNode, len(nodes))
+	running := 0
+
+	start := func(node *ExecNode) {
+		node.SetStarted()
+		running++
+
+		go func() {
+			defer func() {
+				finished <- node
+			}()
+
+			for _, parentNode := range node.parents {
+				if parentErr := parentNode.ExecError(); isCancellation(parentErr) {
+					node.SetFinishedWithError(fmt.Errorf("%w: dependency '%s' was cancelled", ErrCancelled, parentNode.resource.Name))
+					return
+				} else if parentErr != nil {
+					node.SetFinishedWithError(fmt.Errorf("dependency '%s' failed", parentNode.resource.Name))
+					return
+				}
+			}
+
+			if sem != nil {
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+				case <-ctx.Done():
+				}
+			}
 
-		if allFinished := areAllNodesFinished(nodes); allFinished {
-			break
+			if ctx.Err() != nil {
+				node.SetFinishedWithError(fmt.Errorf("%w: %v", ErrCancelled, ctx.Err()))
+				return
+			}
+
+			err := execFunc(ctx, node.resource)
+
+			if err != nil {
+				node.SetFinishedWithError(err)
+				return
+			}
+
+			node.SetFinished()
+		}()
+	}
+
+	for _, node := range nodes {
+		if remainingParents[node] == 0 {
+			start(node)
 		}
 	}
-}
 
-func areAllNodesFinished(nodes []*ExecNode) bool {
-	areFinished := true
+	for running > 0 {
+		node := <-finished
+		running--
 
+		for _, child := range children[node] {
+			remainingParents[child]--
+
+			if remainingParents[child] == 0 {
+				start(child)
+			}
+		}
+	}
+
+	// any nodes which never started are part of a dependency cycle
 	for _, node := range nodes {
-		areFinished = areFinished && node.IsFinished()
+		if !node.IsStarted() {
+			node.SetFinishedWithError(fmt.Errorf("resource '%s' could not be scheduled: circular dependency detected", node.resource.Name))
+		}
 	}
+}
 
-	return areFinished
+// isCancellation returns true if the error was caused by a cancelled or timed out
+// context
+func isCancellation(err error) bool {
+	return err != nil && (errors.Is(err, ErrCancelled) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded))
 }
@@ -0,0 +1,212 @@
+package exec_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/porter-dev/switchboard/internal/exec"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestNodes(t *testing.T, resources ...*models.Resource) []*exec.ExecNode {
+	nodes, err := exec.GetExecNodes(&models.ResourceGroup{
+		Resources: resources,
+	})
+
+	assert.NoError(t, err, "getting exec nodes should not throw error")
+
+	return nodes
+}
+
+func getNodeErrors(nodes []*exec.ExecNode) map[string]error {
+	res := make(map[string]error)
+
+	for _, node := range nodes {
+		res[node.ResourceName()] = node.ExecError()
+	}
+
+	return res
+}
+
+func TestExecuteDependencyOrder(t *testing.T) {
+	nodes := getTestNodes(t,
+		&models.Resource{Name: "a"},
+		&models.Resource{Name: "b", Dependencies: []string{"a"}},
+		&models.Resource{Name: "c", Dependencies: []string{"a", "b"}},
+	)
+
+	var mu sync.Mutex
+	order := make([]string, 0)
+
+	exec.Execute(context.Background(), nodes, func(ctx context.Context, resource *models.Resource) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		order = append(order, resource.Name)
+		return nil
+	}, nil)
+
+	assert.Equal(t, []string{"a", "b", "c"}, order, "nodes execute after their parents")
+
+	for _, node := range nodes {
+		assert.True(t, node.IsFinished(), "all nodes are finished")
+	}
+}
+
+func TestExecuteDoesNotWaitForSiblings(t *testing.T) {
+	nodes := getTestNodes(t,
+		&models.Resource{Name: "slow"},
+		&models.Resource{Name: "fast"},
+		&models.Resource{Name: "fast-child", Dependencies: []string{"fast"}},
+	)
+
+	var mu sync.Mutex
+	finishOrder := make([]string, 0)
+
+	exec.Execute(context.Background(), nodes, func(ctx context.Context, resource *models.Resource) error {
+		if resource.Name == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		finishOrder = append(finishOrder, resource.Name)
+		return nil
+	}, nil)
+
+	assert.Equal(t, []string{"fast", "fast-child", "slow"}, finishOrder, "child starts as soon as its parent finishes")
+}
+
+func TestExecuteMaxParallelism(t *testing.T) {
+	resources := make([]*models.Resource, 0)
+
+	for i := 0; i < 10; i++ {
+		resources = append(resources, &models.Resource{Name: fmt.Sprintf("resource-%d", i)})
+	}
+
+	nodes := getTestNodes(t, resources...)
+
+	var current, max int32
+
+	exec.Execute(context.Background(), nodes, func(ctx context.Context, resource *models.Resource) error {
+		val := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+
+		for {
+			prevMax := atomic.LoadInt32(&max)
+
+			if val <= prevMax || atomic.CompareAndSwapInt32(&max, prevMax, val) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		return nil
+	}, &exec.ExecuteOpts{
+		MaxParallelism: 2,
+	})
+
+	assert.LessOrEqual(t, max, int32(2), "no more than 2 nodes execute concurrently")
+}
+
+func TestExecuteFailedDependency(t *testing.T) {
+	nodes := getTestNodes(t,
+		&models.Resource{Name: "a"},
+		&models.Resource{Name: "b", Dependencies: []string{"a"}},
+		&models.Resource{Name: "c", Dependencies: []string{"b"}},
+		&models.Resource{Name: "d"},
+	)
+
+	executed := make(map[string]bool)
+	var mu sync.Mutex
+
+	exec.Execute(context.Background(), nodes, func(ctx context.Context, resource *models.Resource) error {
+		mu.Lock()
+		executed[resource.Name] = true
+		mu.Unlock()
+
+		if resource.Name == "a" {
+			return fmt.Errorf("failed")
+		}
+
+		return nil
+	}, nil)
+
+	errors := getNodeErrors(nodes)
+
+	assert.EqualError(t, errors["a"], "failed")
+	assert.EqualError(t, errors["b"], "dependency 'a' failed")
+	assert.EqualError(t, errors["c"], "dependency 'b' failed")
+	assert.NoError(t, errors["d"], "independent node succeeds")
+	assert.False(t, executed["b"] || executed["c"], "dependents of failed nodes are not executed")
+}
+
+func TestExecuteCancelled(t *testing.T) {
+	nodes := getTestNodes(t,
+		&models.Resource{Name: "a"},
+		&models.Resource{Name: "b", Dependencies: []string{"a"}},
+		&models.Resource{Name: "c", Dependencies: []string{"b"}},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	exec.Execute(ctx, nodes, func(ctx context.Context, resource *models.Resource) error {
+		// cancel while the first resource is executing, and wait for cancellation
+		cancel()
+		<-ctx.Done()
+
+		return ctx.Err()
+	}, nil)
+
+	for _, node := range nodes {
+		assert.True(t, node.IsFinished(), "%s is finished", node.ResourceName())
+		assert.True(t, node.IsCancelled(), "%s is cancelled", node.ResourceName())
+	}
+
+	errors := getNodeErrors(nodes)
+
+	assert.ErrorIs(t, errors["b"], exec.ErrCancelled)
+	assert.EqualError(t, errors["b"], "cancelled: dependency 'a' was cancelled")
+}
+
+func TestExecuteReverse(t *testing.T) {
+	nodes, err := exec.GetReverseExecNodes(&models.ResourceGroup{
+		Resources: []*models.Resource{
+			{Name: "a"},
+			{Name: "b", Dependencies: []string{"a"}},
+			{Name: "c", Dependencies: []string{"b"}},
+		},
+	})
+
+	assert.NoError(t, err, "getting reverse exec nodes should not throw error")
+
+	order := make([]string, 0)
+	var mu sync.Mutex
+
+	exec.Execute(context.Background(), nodes, func(ctx context.Context, resource *models.Resource) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		order = append(order, resource.Name)
+		return nil
+	}, nil)
+
+	assert.Equal(t, []string{"c", "b", "a"}, order, "dependents execute before their dependencies")
+}
+
+func TestResolveCircularDependency(t *testing.T) {
+	resolver := exec.NewDependencyResolver([]*models.Resource{
+		{Name: "a"},
+		{Name: "b", Dependencies: []string{"c"}},
+		{Name: "c", Dependencies: []string{"b"}},
+	})
+
+	assert.Error(t, resolver.Resolve(), "cycle not reachable from the first resource is detected")
+}
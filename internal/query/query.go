@@ -1,6 +1,7 @@
 package query
 
 import (
+	"reflect"
 	"regexp"
 
 	"github.com/porter-dev/switchboard/internal/query/jsonpath"
@@ -9,43 +10,122 @@ import (
 // PopulateQuery reads through config to detect queries. If a query is found, the data
 // is queried and the relevant field is populated in the config. This method is recursive.
 func PopulateQueries(config map[string]interface{}, data map[string]interface{}) (map[string]interface{}, error) {
-	iter := queryIterator{data, make([]error, 0)}
-	res := iter.iterMap(config)
+	res, _, err := PopulateSensitiveQueries(config, data, nil)
 
-	return res, nil
+	return res, err
+}
+
+// PopulateSensitiveQueries populates queries in the same way as PopulateQueries, where
+// dataMask marks the sensitive values in data. It also returns a mask of the values in
+// the populated config which were read from sensitive values, or nil if there are none.
+//
+// A query result is sensitive if it changes when the query is run against the data with
+// every sensitive value redacted, so results which are built from sensitive values, or
+// filtered by them, are sensitive as well.
+func PopulateSensitiveQueries(
+	config map[string]interface{},
+	data map[string]interface{},
+	dataMask map[string]interface{},
+) (map[string]interface{}, map[string]interface{}, error) {
+	return PopulateMaskedQueries(config, nil, data, dataMask)
+}
+
+// PopulateMaskedQueries populates queries in the same way as PopulateSensitiveQueries,
+// where configMask marks the values in config which are already sensitive, like resolved
+// secrets. Values marked by configMask are never parsed as queries, since they may
+// contain braces, and they are marked in the returned mask.
+func PopulateMaskedQueries(
+	config map[string]interface{},
+	configMask map[string]interface{},
+	data map[string]interface{},
+	dataMask map[string]interface{},
+) (map[string]interface{}, map[string]interface{}, error) {
+	iter := queryIterator{data: data, errors: make([]error, 0)}
+
+	if len(dataMask) > 0 {
+		iter.redactedData = Redact(data, dataMask).(map[string]interface{})
+	}
+
+	res, mask := iter.iterMap(config, configMask)
+
+	if mask == nil {
+		return res, nil, nil
+	}
+
+	return res, mask.(map[string]interface{}), nil
 }
 
 type queryIterator struct {
 	data   map[string]interface{}
 	errors []error
+
+	// redactedData is the data with sensitive values redacted, or nil if no values are
+	// sensitive
+	redactedData map[string]interface{}
 }
 
-func (q *queryIterator) iterSlice(arr []interface{}) []interface{} {
+func (q *queryIterator) iterSlice(arr []interface{}, arrMask interface{}) ([]interface{}, interface{}) {
 	res := make([]interface{}, 0)
+	mask := make([]interface{}, len(arr))
+	isSensitive := false
+	maskSlice, _ := arrMask.([]interface{})
+
+	for i, arrVal := range arr {
+		var nestedMask interface{}
+
+		if i < len(maskSlice) {
+			nestedMask = maskSlice[i]
+		}
+
+		val, valMask := q.iterInterface(arrVal, nestedMask)
 
-	for _, arrVal := range arr {
-		res = append(res, q.iterInterface(arrVal))
+		res = append(res, val)
+		mask[i] = valMask
+
+		if valMask != nil {
+			isSensitive = true
+		}
+	}
+
+	if !isSensitive {
+		return res, nil
 	}
 
-	return res
+	return res, mask
 }
 
-func (q *queryIterator) iterMap(mapVal map[string]interface{}) map[string]interface{} {
+func (q *queryIterator) iterMap(mapVal map[string]interface{}, mapMask interface{}) (map[string]interface{}, interface{}) {
 	res := make(map[string]interface{})
+	mask := make(map[string]interface{})
+	maskMap, _ := mapMask.(map[string]interface{})
 
 	for key, val := range mapVal {
-		res[key] = q.iterInterface(val)
+		var valMask interface{}
+
+		res[key], valMask = q.iterInterface(val, maskMap[key])
+
+		if valMask != nil {
+			mask[key] = valMask
+		}
 	}
 
-	return res
+	if len(mask) == 0 {
+		return res, nil
+	}
+
+	return res, mask
 }
 
-func (q *queryIterator) iterInterface(val interface{}) interface{} {
+func (q *queryIterator) iterInterface(val interface{}, valMask interface{}) (interface{}, interface{}) {
+	if isMasked, ok := valMask.(bool); ok && isMasked {
+		return val, true
+	}
+
 	switch val.(type) {
 	case []interface{}:
-		return q.iterSlice(val.([]interface{}))
+		return q.iterSlice(val.([]interface{}), valMask)
 	case map[string]interface{}:
-		return q.iterMap(val.(map[string]interface{}))
+		return q.iterMap(val.(map[string]interface{}), valMask)
 	case string:
 		// TODO: move out to higher-level func
 		bracesReg := regexp.MustCompile(`\{(.+)\}`)
@@ -56,14 +136,22 @@ func (q *queryIterator) iterInterface(val interface{}) interface{} {
 
 			if err != nil {
 				q.errors = append(q.errors, err)
-				return val
+				return val, nil
+			}
+
+			if q.redactedData != nil {
+				redactedRes, err := jsonpath.GetResult(q.redactedData, val.(string))
+
+				if err != nil || !reflect.DeepEqual(res, redactedRes) {
+					return res, true
+				}
 			}
 
-			return res
+			return res, nil
 		}
 
-		return val
+		return val, nil
 	default:
-		return val
+		return val, nil
 	}
 }
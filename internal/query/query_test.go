@@ -0,0 +1,90 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/porter-dev/switchboard/internal/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPopulateSensitiveQueries(t *testing.T) {
+	data := map[string]interface{}{
+		"rds": map[string]interface{}{
+			"host":     "db.internal",
+			"password": "hunter2",
+			"credentials": map[string]interface{}{
+				"username": "admin",
+			},
+		},
+	}
+
+	dataMask := map[string]interface{}{
+		"rds": map[string]interface{}{
+			"password":    true,
+			"credentials": true,
+		},
+	}
+
+	config, mask, err := query.PopulateSensitiveQueries(map[string]interface{}{
+		"host":     "{ .rds.host }",
+		"password": "{ .rds.password }",
+		"url":      "{ .rds.host }{':'}{ .rds.password }",
+		"env": []interface{}{
+			"{ .rds.host }",
+			"{ .rds.credentials.username }",
+		},
+		"static": "value",
+	}, data, dataMask)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"host":     "db.internal",
+		"password": "hunter2",
+		"url":      "db.internal:hunter2",
+		"env":      []interface{}{"db.internal", "admin"},
+		"static":   "value",
+	}, config)
+	assert.Equal(t, map[string]interface{}{
+		"password": true,
+		"url":      true,
+		"env":      []interface{}{nil, true},
+	}, mask)
+
+	assert.Equal(t, map[string]interface{}{
+		"host":     "db.internal",
+		"password": query.Redacted,
+		"url":      query.Redacted,
+		"env":      []interface{}{"db.internal", query.Redacted},
+		"static":   "value",
+	}, query.Redact(config, mask))
+
+	assert.Equal(t, []string{"admin", "db.internal:hunter2", "hunter2"}, query.SensitiveStrings(config, mask))
+}
+
+func TestPopulateMaskedQueries(t *testing.T) {
+	data := map[string]interface{}{
+		"rds": map[string]interface{}{
+			"host": "db.internal",
+		},
+	}
+
+	config, mask, err := query.PopulateMaskedQueries(map[string]interface{}{
+		"host":     "{ .rds.host }",
+		"password": "p{ss}word",
+		"env":      []interface{}{"{ .rds.host }", "{token}"},
+	}, map[string]interface{}{
+		"password": true,
+		"env":      []interface{}{nil, true},
+	}, data, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"host":     "db.internal",
+		"password": "p{ss}word",
+		"env":      []interface{}{"db.internal", "{token}"},
+	}, config)
+	assert.Equal(t, map[string]interface{}{
+		"password": true,
+		"env":      []interface{}{nil, true},
+	}, mask)
+}
@@ -0,0 +1,229 @@
+package query
+
+import "sort"
+
+// Redacted is the value that sensitive values are replaced with
+const Redacted = "(sensitive value)"
+
+// Redact returns a copy of val in which every value marked by the mask is replaced by
+// Redacted. A mask mirrors the structure of the value that it marks: a mask of true
+// marks the whole value as sensitive, while a map or slice mask marks the values at the
+// same keys or indices. Values which are not in the mask are not sensitive.
+func Redact(val interface{}, mask interface{}) interface{} {
+	switch maskVal := mask.(type) {
+	case bool:
+		if maskVal {
+			return Redacted
+		}
+	case map[string]interface{}:
+		if mapVal, ok := val.(map[string]interface{}); ok && mapVal != nil {
+			res := make(map[string]interface{}, len(mapVal))
+
+			for key, nestedVal := range mapVal {
+				res[key] = Redact(nestedVal, maskVal[key])
+			}
+
+			return res
+		}
+	case []interface{}:
+		if sliceVal, ok := val.([]interface{}); ok {
+			res := make([]interface{}, len(sliceVal))
+
+			for i, nestedVal := range sliceVal {
+				if i < len(maskVal) {
+					res[i] = Redact(nestedVal, maskVal[i])
+				} else {
+					res[i] = nestedVal
+				}
+			}
+
+			return res
+		}
+	}
+
+	return val
+}
+
+// SensitiveStrings returns the string values marked by the mask, so that they can be
+// redacted from text such as logs. Numbers, booleans and empty strings are not returned,
+// since redacting them would also redact unrelated text.
+func SensitiveStrings(val interface{}, mask interface{}) []string {
+	res := make([]string, 0)
+
+	collectSensitiveStrings(val, mask, false, &res)
+
+	sort.Strings(res)
+
+	return res
+}
+
+func collectSensitiveStrings(val interface{}, mask interface{}, isSensitive bool, res *[]string) {
+	if maskVal, ok := mask.(bool); ok && maskVal {
+		isSensitive = true
+	}
+
+	switch typedVal := val.(type) {
+	case map[string]interface{}:
+		maskMap, _ := mask.(map[string]interface{})
+
+		for key, nestedVal := range typedVal {
+			collectSensitiveStrings(nestedVal, maskMap[key], isSensitive, res)
+		}
+	case []interface{}:
+		maskSlice, _ := mask.([]interface{})
+
+		for i, nestedVal := range typedVal {
+			var nestedMask interface{}
+
+			if i < len(maskSlice) {
+				nestedMask = maskSlice[i]
+			}
+
+			collectSensitiveStrings(nestedVal, nestedMask, isSensitive, res)
+		}
+	case string:
+		if isSensitive && typedVal != "" {
+			*res = append(*res, typedVal)
+		}
+	}
+}
+
+// MergeMasks returns a mask which marks every value marked by either mask
+func MergeMasks(a, b map[string]interface{}) map[string]interface{} {
+	if len(a) == 0 {
+		return b
+	} else if len(b) == 0 {
+		return a
+	}
+
+	res := make(map[string]interface{}, len(a))
+
+	for key, val := range a {
+		res[key] = val
+	}
+
+	for key, val := range b {
+		res[key] = mergeMask(res[key], val)
+	}
+
+	return res
+}
+
+func mergeMask(a, b interface{}) interface{} {
+	if a == nil {
+		return b
+	} else if b == nil {
+		return a
+	}
+
+	if isSensitive, _ := a.(bool); isSensitive {
+		return a
+	} else if isSensitive, _ := b.(bool); isSensitive {
+		return b
+	}
+
+	aMap, aIsMap := a.(map[string]interface{})
+	bMap, bIsMap := b.(map[string]interface{})
+
+	if aIsMap && bIsMap {
+		return MergeMasks(aMap, bMap)
+	}
+
+	aSlice, aIsSlice := a.([]interface{})
+	bSlice, bIsSlice := b.([]interface{})
+
+	if aIsSlice && bIsSlice {
+		res := make([]interface{}, len(aSlice))
+
+		for i := range aSlice {
+			if i < len(bSlice) {
+				res[i] = mergeMask(aSlice[i], bSlice[i])
+			} else {
+				res[i] = aSlice[i]
+			}
+		}
+
+		return res
+	}
+
+	return a
+}
+
+// Select returns the values in val which are marked by the mask, in the same structure
+// as val. Maps only keep marked keys, and slices keep their length, with nil in place of
+// values which are not marked. Select returns nil if no values are marked.
+func Select(val interface{}, mask interface{}) interface{} {
+	switch maskVal := mask.(type) {
+	case bool:
+		if maskVal {
+			return val
+		}
+	case map[string]interface{}:
+		mapVal, _ := val.(map[string]interface{})
+		res := make(map[string]interface{})
+
+		for key, nestedVal := range mapVal {
+			if selected := Select(nestedVal, maskVal[key]); selected != nil {
+				res[key] = selected
+			}
+		}
+
+		if len(res) > 0 {
+			return res
+		}
+	case []interface{}:
+		sliceVal, _ := val.([]interface{})
+		res := make([]interface{}, len(sliceVal))
+		isSelected := false
+
+		for i, nestedVal := range sliceVal {
+			if i < len(maskVal) {
+				res[i] = Select(nestedVal, maskVal[i])
+				isSelected = isSelected || res[i] != nil
+			}
+		}
+
+		if isSelected {
+			return res
+		}
+	}
+
+	return nil
+}
+
+// RedactedMask returns a mask which marks every value in val that is equal to Redacted,
+// or nil if there are none. This recovers the mask of a value which was redacted.
+func RedactedMask(val interface{}) interface{} {
+	switch typedVal := val.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{})
+
+		for key, nestedVal := range typedVal {
+			if nestedMask := RedactedMask(nestedVal); nestedMask != nil {
+				res[key] = nestedMask
+			}
+		}
+
+		if len(res) > 0 {
+			return res
+		}
+	case []interface{}:
+		res := make([]interface{}, len(typedVal))
+		isRedacted := false
+
+		for i, nestedVal := range typedVal {
+			res[i] = RedactedMask(nestedVal)
+			isRedacted = isRedacted || res[i] != nil
+		}
+
+		if isRedacted {
+			return res
+		}
+	case string:
+		if typedVal == Redacted {
+			return true
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,9 @@
 package drivers
 
 import (
+	"context"
+	"time"
+
 	"github.com/porter-dev/switchboard/internal/query"
 	"github.com/porter-dev/switchboard/pkg/models"
 	"github.com/rs/zerolog"
@@ -10,6 +13,31 @@ type SharedDriverOpts struct {
 	BaseDir           string
 	DriverLookupTable *map[string]Driver
 	Logger            *zerolog.Logger
+
+	// CacheDir is the directory where drivers cache downloaded artifacts. If it is
+	// empty, nothing is cached.
+	CacheDir string
+
+	// ChartIndexTTL is the duration that cached Helm repository indexes are used for
+	ChartIndexTTL time.Duration
+}
+
+// PlanAction is the type of change that a driver would make to a resource
+type PlanAction string
+
+const (
+	PlanActionCreate PlanAction = "create"
+	PlanActionUpdate PlanAction = "update"
+	PlanActionNoop   PlanAction = "no-op"
+)
+
+// Plan is a preview of the changes that a driver would make when applying a resource
+type Plan struct {
+	// Action is the type of change that would be made
+	Action PlanAction
+
+	// Diff is a human-readable diff between the live and desired state
+	Diff string
 }
 
 type QueryFunc func(data map[string]interface{}, query string) (interface{}, error)
@@ -18,35 +46,127 @@ type Driver interface {
 	// ShouldApply returns true if the resource should be applied, false otherwise.
 	// This enables the driver to pass pre-flight checks or detect if the configuration
 	// has changed.
-	ShouldApply(resource *models.Resource) bool
+	ShouldApply(ctx context.Context, resource *models.Resource) bool
 
 	// Apply writes the resource to the target.
-	Apply(resource *models.Resource) (*models.Resource, error)
+	Apply(ctx context.Context, resource *models.Resource) (*models.Resource, error)
+
+	// Plan computes the changes that Apply would make to the target without
+	// mutating it. After Plan is called, Output should return the predicted output
+	// of the resource, so that dependents can be planned as well.
+	Plan(ctx context.Context, resource *models.Resource) (*Plan, error)
+
+	// Delete removes the resource from the target. Deleting a resource that does
+	// not exist should not return an error.
+	Delete(ctx context.Context, resource *models.Resource) (*models.Resource, error)
 
 	// Output returns output data from the resource.
-	Output() (map[string]interface{}, error)
+	Output(ctx context.Context) (map[string]interface{}, error)
+}
+
+// RollbackDriver is implemented by drivers which support atomic applies. Before a
+// resource is applied, Checkpoint records the current revision of the resource. If the
+// resource group fails to apply, Rollback restores the recorded revision, or removes
+// the resource if it did not exist when it was checkpointed.
+type RollbackDriver interface {
+	Checkpoint(ctx context.Context, resource *models.Resource) error
+
+	// Rollback is called with the resource as it was applied in the failed run, and
+	// with the resource as it was last applied before that run. previous is nil if it
+	// was not recorded in the state, or if its decrypted values were redacted from the
+	// state and have changed since.
+	Rollback(ctx context.Context, current, previous *models.Resource) error
+}
+
+// WaitDriver is implemented by drivers which can wait for a resource to become ready.
+// Wait is called after the resource is applied, or after it is found to be unchanged,
+// and blocks until the checks in the resource's wait block pass. Once Wait returns,
+// Output should reflect the final observed state of the resource.
+type WaitDriver interface {
+	Wait(ctx context.Context, resource *models.Resource) error
+}
+
+// SensitiveOutputDriver is implemented by drivers whose output can contain sensitive
+// values. SensitiveOutput returns a mask which mirrors the structure of the output: a
+// value of true marks the value at the same key as sensitive, and nested maps and
+// slices mark nested values. Sensitive values are redacted from logs, plans and hook
+// data, and queries which read them are sensitive in the dependent's config.
+type SensitiveOutputDriver interface {
+	SensitiveOutput(ctx context.Context) (map[string]interface{}, error)
+}
+
+// SensitiveConfigDriver is implemented by drivers which know that some values in a
+// resource's config are sensitive, for example because they set variables that are
+// declared as sensitive. SensitiveConfig returns a mask of the resource's constructed
+// config, in the same form as the mask returned by SensitiveOutput. Sensitive values
+// are redacted from logs, plans and hook data.
+type SensitiveConfigDriver interface {
+	SensitiveConfig(ctx context.Context, resource *models.Resource) (map[string]interface{}, error)
+}
+
+// GetOutput returns the output of a driver, along with the mask of its sensitive values.
+// The mask is nil if the driver does not mark any values as sensitive.
+func GetOutput(ctx context.Context, driver Driver) (map[string]interface{}, map[string]interface{}, error) {
+	output, err := driver.Output(ctx)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sensitiveDriver, ok := driver.(SensitiveOutputDriver)
+
+	if !ok {
+		return output, nil, nil
+	}
+
+	mask, err := sensitiveDriver.SensitiveOutput(ctx)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output, mask, nil
 }
 
 type DriverFunc func(*models.Resource, *SharedDriverOpts) (Driver, error)
 
 type ConstructConfigOpts struct {
-	RawConf      map[string]interface{}
+	RawConf map[string]interface{}
+
+	// RawConfMask marks the values in RawConf which are sensitive, like resolved
+	// secrets. These values are not parsed as queries.
+	RawConfMask map[string]interface{}
+
 	LookupTable  map[string]Driver
 	Dependencies []string
 }
 
-func ConstructConfig(opts *ConstructConfigOpts) (map[string]interface{}, error) {
+func ConstructConfig(ctx context.Context, opts *ConstructConfigOpts) (map[string]interface{}, error) {
+	config, _, err := ConstructSensitiveConfig(ctx, opts)
+
+	return config, err
+}
+
+// ConstructSensitiveConfig constructs the config in the same way as ConstructConfig, and
+// also returns a mask of the config values which were read from sensitive outputs of the
+// dependencies, or which are marked by RawConfMask. The mask is nil if no values are sensitive.
+func ConstructSensitiveConfig(ctx context.Context, opts *ConstructConfigOpts) (map[string]interface{}, map[string]interface{}, error) {
 	dataMap := make(map[string]interface{})
+	dataMask := make(map[string]interface{})
 
 	for _, dependency := range opts.Dependencies {
-		depOutput, err := opts.LookupTable[dependency].Output()
+		depOutput, depMask, err := GetOutput(ctx, opts.LookupTable[dependency])
 
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		dataMap[dependency] = depOutput
+
+		if depMask != nil {
+			dataMask[dependency] = depMask
+		}
 	}
 
-	return query.PopulateQueries(opts.RawConf, dataMap)
+	return query.PopulateMaskedQueries(opts.RawConf, opts.RawConfMask, dataMap, dataMask)
 }
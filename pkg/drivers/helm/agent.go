@@ -1,19 +1,34 @@
 package helm
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
 
 	helmloader "helm.sh/helm/v3/pkg/chart/loader"
 
+	"github.com/porter-dev/switchboard/pkg/drivers"
 	"github.com/porter-dev/switchboard/pkg/drivers/helm/loader"
 	"github.com/porter-dev/switchboard/pkg/drivers/kubernetes"
+	"github.com/porter-dev/switchboard/utils/objutils"
 	"github.com/rs/zerolog"
 )
 
+// defaultTimeout is the timeout for Helm operations if no deadline is set
+const defaultTimeout = 5 * time.Minute
+
 // Agent is a Helm agent for performing helm operations
 type Agent struct {
 	ActionConfig *action.Configuration
@@ -29,19 +44,147 @@ type ApplyOpts struct {
 	Target *Target
 }
 
-func (a *Agent) Apply(opts *ApplyOpts) (*release.Release, error) {
-	err := a.loadRelease(opts.Source, opts.Target)
+func (a *Agent) Apply(ctx context.Context, opts *ApplyOpts) (*release.Release, error) {
+	err := a.loadRelease(ctx, opts.Source, opts.Target)
 
 	if err != nil {
 		// if error is not nil, we create the chart
-		return a.installChart(opts.Source, opts.Target, opts.Config)
+		return a.installChart(ctx, opts.Source, opts.Target, opts.Config, false)
+	}
+
+	return a.upgradeRelease(ctx, opts.Source, opts.Target, opts.Config, false)
+}
+
+// Delete uninstalls the release. If the release does not exist, no error is returned.
+func (a *Agent) Delete(ctx context.Context, target *Target) error {
+	cmd := action.NewUninstall(a.ActionConfig)
+	cmd.Timeout = getTimeout(ctx)
+
+	_, err := cmd.Run(target.Name)
+
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return fmt.Errorf("Uninstall failed: %v", err)
+	}
+
+	return nil
+}
+
+// GetRevision returns the revision of the latest release, or 0 if the release does
+// not exist
+func (a *Agent) GetRevision(ctx context.Context, target *Target) (int, error) {
+	cmd := action.NewGet(a.ActionConfig)
+	cmd.Version = 0
+
+	rel, err := cmd.Run(target.Name)
+
+	if err != nil && errors.Is(err, driver.ErrReleaseNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("error getting the release: %v", err)
+	}
+
+	return rel.Version, nil
+}
+
+// Rollback rolls the release back to a previous revision, and returns the restored
+// release. If the revision is 0, the release is uninstalled.
+func (a *Agent) Rollback(ctx context.Context, target *Target, revision int) (*release.Release, error) {
+	if revision == 0 {
+		return nil, a.Delete(ctx, target)
+	}
+
+	cmd := action.NewRollback(a.ActionConfig)
+	cmd.Version = revision
+	cmd.Timeout = getTimeout(ctx)
+
+	err := cmd.Run(target.Name)
+
+	if err != nil {
+		return nil, fmt.Errorf("Rollback failed: %v", err)
+	}
+
+	err = a.loadRelease(ctx, nil, target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a.release, nil
+}
+
+// Plan performs a dry run of the install or upgrade, and returns a diff between the
+// manifest and values of the live release and the dry run release.
+func (a *Agent) Plan(ctx context.Context, opts *ApplyOpts) (*drivers.Plan, *release.Release, error) {
+	err := a.loadRelease(ctx, opts.Source, opts.Target)
+
+	if err != nil {
+		rel, err := a.installChart(ctx, opts.Source, opts.Target, opts.Config, true)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		diff, err := diffRelease(nil, rel)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return &drivers.Plan{
+			Action: drivers.PlanActionCreate,
+			Diff:   diff,
+		}, rel, nil
+	}
+
+	rel, err := a.upgradeRelease(ctx, opts.Source, opts.Target, opts.Config, true)
+
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return a.upgradeRelease(opts.Source, opts.Target, opts.Config)
+	diff, err := diffRelease(a.release, rel)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan := &drivers.Plan{
+		Action: drivers.PlanActionUpdate,
+		Diff:   diff,
+	}
+
+	if diff == "" {
+		plan.Action = drivers.PlanActionNoop
+	}
+
+	return plan, rel, nil
+}
+
+// diffRelease computes a diff of the values and manifests of two releases. A nil
+// release is treated as empty.
+func diffRelease(from, to *release.Release) (string, error) {
+	var fromValues map[string]interface{}
+	var fromManifest string
+
+	if from != nil {
+		fromValues = from.Config
+		fromManifest = from.Manifest
+	}
+
+	valuesDiff, err := objutils.DiffYAML(fromValues, to.Config)
+
+	if err != nil {
+		return "", err
+	}
+
+	manifestDiff := objutils.DiffText(fromManifest, to.Manifest)
+
+	return valuesDiff + manifestDiff, nil
 }
 
 // GetRelease returns the info of a release.
 func (a *Agent) loadRelease(
+	ctx context.Context,
 	source *Source,
 	target *Target,
 ) error {
@@ -59,22 +202,49 @@ func (a *Agent) loadRelease(
 	a.release = release
 
 	if release.Chart != nil && release.Chart.Metadata != nil {
-		loadDependencies(release.Chart)
+		var cache *loader.Cache
+
+		if source != nil {
+			cache = source.Cache
+		}
+
+		loadDependencies(ctx, cache, release.Chart)
 	}
 
 	return nil
 }
 
+// upgradeRelease upgrades the live release to the chart declared by the source. The
+// chart is reloaded from the source, so changes to the chart version or to a local chart
+// are applied.
 func (a *Agent) upgradeRelease(
+	ctx context.Context,
 	source *Source,
 	target *Target,
 	values map[string]interface{},
+	dryRun bool,
 ) (*release.Release, error) {
-	ch := a.release.Chart
+	ch, err := loadChart(ctx, source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		a.logVersionChange(target, a.release.Chart, ch)
+	}
+
 	cmd := action.NewUpgrade(a.ActionConfig)
 	cmd.Namespace = target.Namespace
+	cmd.DryRun = dryRun
+	cmd.Timeout = getTimeout(ctx)
+	cmd.ReuseValues = target.ReuseValues
+	cmd.ResetValues = target.ResetValues
+	cmd.Atomic = target.Atomic
+	cmd.Wait = target.Wait
+	cmd.MaxHistory = target.MaxHistory
 
-	res, err := cmd.Run(target.Name, ch, values)
+	res, err := cmd.RunWithContext(ctx, target.Name, ch, values)
 
 	if err != nil {
 		return nil, fmt.Errorf("Upgrade failed: %v", err)
@@ -83,34 +253,160 @@ func (a *Agent) upgradeRelease(
 	return res, nil
 }
 
+// logVersionChange logs the chart version of an upgrade if it differs from the version
+// of the live release, and warns if the chart is downgraded
+func (a *Agent) logVersionChange(target *Target, from, to *chart.Chart) {
+	if a.Logger == nil || from == nil || from.Metadata == nil || to.Metadata == nil {
+		return
+	}
+
+	fromVersion := from.Metadata.Version
+	toVersion := to.Metadata.Version
+
+	if fromVersion == toVersion {
+		return
+	}
+
+	event := a.Logger.Info()
+
+	fromSemver, fromErr := semver.NewVersion(fromVersion)
+	toSemver, toErr := semver.NewVersion(toVersion)
+
+	if fromErr == nil && toErr == nil && toSemver.LessThan(fromSemver) {
+		event = a.Logger.Warn()
+	}
+
+	event.Str("release", target.Name).Msgf("upgrading chart %s from version %s to %s", to.Name(), fromVersion, toVersion)
+}
+
 // installChart installs a new chart
 func (a *Agent) installChart(
+	ctx context.Context,
 	source *Source,
 	target *Target,
 	values map[string]interface{},
+	dryRun bool,
 ) (*release.Release, error) {
 	cmd := action.NewInstall(a.ActionConfig)
 	cmd.ReleaseName = target.Name
 	cmd.Namespace = target.Namespace
-	cmd.Timeout = 300
+	cmd.Timeout = getTimeout(ctx)
+	cmd.DryRun = dryRun
+	cmd.Atomic = target.Atomic
+	cmd.Wait = target.Wait
 
-	// depending on the source, we load the chart
-	var err error
-	var chart *chart.Chart
-	if source.Kind == SourceKindRepository {
-		chart, err = loader.LoadChartPublic(source.ChartRepoURL, source.ChartName, source.ChartVersion)
-	} else if source.Kind == SourceKindLocal {
-		chart, err = helmloader.Load(source.SourceLocal.Path)
-	}
+	chart, err := loadChart(ctx, source)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return cmd.Run(chart, values)
+	return cmd.RunWithContext(ctx, chart, values)
 }
 
-func loadDependencies(chart *chart.Chart) {
+// getTimeout returns the time remaining until the context deadline, or the default
+// timeout if the context has no deadline. Helm uses this timeout when waiting on
+// hooks and resources.
+func getTimeout(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+
+	return defaultTimeout
+}
+
+// loadChart loads the chart declared by the source
+func loadChart(ctx context.Context, source *Source) (*chart.Chart, error) {
+	switch source.Kind {
+	case SourceKindRepository:
+		return loader.LoadChart(ctx, source.Client, source.Cache, source.ChartRepoURL, source.ChartName, source.ChartVersion)
+	case SourceKindOCI:
+		return loader.LoadOCIChart(ctx, source.Client, source.Cache, source.ChartRepoURL, source.ChartName, source.ChartVersion)
+	case SourceKindLocal:
+		return helmloader.Load(source.SourceLocal.Path)
+	}
+
+	return nil, fmt.Errorf("unsupported source kind %s", source.Kind)
+}
+
+// IsUpToDate returns true if the live release was deployed from the same chart as the
+// source, with the same values. If it is up to date, the live release is returned.
+func (a *Agent) IsUpToDate(ctx context.Context, opts *ApplyOpts) (bool, *release.Release, error) {
+	err := a.loadRelease(ctx, opts.Source, opts.Target)
+
+	if err != nil {
+		// the release does not exist
+		return false, nil, nil
+	}
+
+	if a.release.Info == nil || a.release.Info.Status != release.StatusDeployed {
+		return false, nil, nil
+	}
+
+	ch, err := loadChart(ctx, opts.Source)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	sourceDigest, err := chartDigest(ch)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	liveDigest, err := chartDigest(a.release.Chart)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	if sourceDigest != liveDigest {
+		return false, nil, nil
+	}
+
+	sourceValues, err := json.Marshal(opts.Config)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	liveValues, err := json.Marshal(a.release.Config)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	if !bytes.Equal(sourceValues, liveValues) {
+		return false, nil, nil
+	}
+
+	return true, a.release, nil
+}
+
+// chartDigest computes a digest of a chart's metadata, default values and templates.
+// Subcharts are not included, since they are not stored with the release.
+func chartDigest(ch *chart.Chart) (string, error) {
+	if ch == nil {
+		return "", nil
+	}
+
+	chBytes, err := json.Marshal(struct {
+		Metadata  *chart.Metadata
+		Values    map[string]interface{}
+		Templates []*chart.File
+	}{ch.Metadata, ch.Values, ch.Templates})
+
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(chBytes)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func loadDependencies(ctx context.Context, cache *loader.Cache, chart *chart.Chart) {
 	for _, dep := range chart.Metadata.Dependencies {
 		depExists := false
 
@@ -124,7 +420,7 @@ func loadDependencies(chart *chart.Chart) {
 		}
 
 		if !depExists {
-			depChart, err := loader.LoadChartPublic(dep.Repository, dep.Name, dep.Version)
+			depChart, err := loadDependency(ctx, cache, dep)
 
 			if err == nil {
 				chart.AddDependency(depChart)
@@ -134,3 +430,12 @@ func loadDependencies(chart *chart.Chart) {
 
 	return
 }
+
+// loadDependency loads a chart dependency from a public chart repository or OCI registry
+func loadDependency(ctx context.Context, cache *loader.Cache, dep *chart.Dependency) (*chart.Chart, error) {
+	if strings.HasPrefix(dep.Repository, loader.OCIScheme) {
+		return loader.LoadOCIChart(ctx, &loader.BasicAuthClient{}, cache, dep.Repository, dep.Name, dep.Version)
+	}
+
+	return loader.LoadChartPublic(ctx, cache, dep.Repository, dep.Name, dep.Version)
+}
@@ -1,6 +1,7 @@
 package helm
 
 import (
+	"fmt"
 	"io/ioutil"
 
 	"helm.sh/helm/v3/pkg/action"
@@ -18,9 +19,13 @@ type GetAgentOpts struct {
 	// The default namespace of the Helm agent
 	Namespace string
 
-	// The storage backend of the Helm agent
+	// The storage backend of the Helm agent, which must be a key of StorageMap.
+	// Defaults to secret.
 	Storage string
 
+	// The DSN of the database used by the sql storage backend
+	SQLConnectionString string
+
 	// A Kubernetes agent
 	Agent *kubernetes.Agent
 
@@ -34,10 +39,37 @@ func GetAgent(opts *GetAgentOpts) (*Agent, error) {
 
 	silentLogger := zerolog.New(ioutil.Discard)
 
-	if err := actionConf.Init(opts.Agent.RESTClientGetter, opts.Namespace, opts.Storage, silentLogger.Printf); err != nil {
+	storageName := opts.Storage
+
+	if storageName == "" {
+		storageName = "secret"
+	}
+
+	newStorage, ok := StorageMap[storageName]
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported Helm storage driver %s", storageName)
+	}
+
+	// the memory driver is replaced below, since Init panics if a storage driver
+	// cannot be initialized
+	if err := actionConf.Init(opts.Agent.RESTClientGetter, opts.Namespace, "memory", silentLogger.Printf); err != nil {
+		return nil, err
+	}
+
+	releases, err := newStorage(&StorageOpts{
+		Logger:              &silentLogger,
+		V1Interface:         opts.Agent.Clientset.CoreV1(),
+		Namespace:           opts.Namespace,
+		SQLConnectionString: opts.SQLConnectionString,
+	})
+
+	if err != nil {
 		return nil, err
 	}
 
+	actionConf.Releases = releases
+
 	// use k8s agent to create Helm agent
 	return &Agent{
 		ActionConfig: actionConf,
@@ -0,0 +1,51 @@
+package helm_test
+
+import (
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/drivers/helm"
+	"github.com/porter-dev/switchboard/pkg/drivers/kubernetes"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func getTestAgentOpts(storage string) *helm.GetAgentOpts {
+	return &helm.GetAgentOpts{
+		Namespace: "default",
+		Storage:   storage,
+		Agent: &kubernetes.Agent{
+			RESTClientGetter: genericclioptions.NewTestConfigFlags(),
+			Clientset:        k8sfake.NewSimpleClientset(),
+		},
+	}
+}
+
+func TestGetAgentStorage(t *testing.T) {
+	agent, err := helm.GetAgent(getTestAgentOpts(""))
+
+	assert.NoError(t, err)
+	assert.Equal(t, driver.SecretsDriverName, agent.ActionConfig.Releases.Name())
+
+	agent, err = helm.GetAgent(getTestAgentOpts("configmap"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, driver.ConfigMapsDriverName, agent.ActionConfig.Releases.Name())
+
+	agent, err = helm.GetAgent(getTestAgentOpts("memory"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, driver.MemoryDriverName, agent.ActionConfig.Releases.Name())
+}
+
+func TestGetAgentInvalidStorage(t *testing.T) {
+	_, err := helm.GetAgent(getTestAgentOpts("etcd"))
+
+	assert.EqualError(t, err, "unsupported Helm storage driver etcd")
+
+	_, err = helm.GetAgent(getTestAgentOpts("sql"))
+
+	assert.EqualError(t, err, "a connection string must be set when using the sql storage driver")
+}
@@ -1,8 +1,14 @@
 package helm
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/porter-dev/switchboard/pkg/drivers"
+	"github.com/porter-dev/switchboard/pkg/drivers/helm/loader"
+	"github.com/porter-dev/switchboard/pkg/drivers/kubernetes"
 	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/porter-dev/switchboard/utils/objutils"
 	"github.com/rs/zerolog"
 )
 
@@ -10,8 +16,14 @@ type Driver struct {
 	source      *Source
 	target      *Target
 	output      map[string]interface{}
+	outputMask  map[string]interface{}
 	lookupTable *map[string]drivers.Driver
 	logger      *zerolog.Logger
+
+	// revision is the release revision recorded by Checkpoint, which is 0 if the
+	// release did not exist
+	revision     int
+	checkpointed bool
 }
 
 func NewHelmDriver(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
@@ -20,12 +32,17 @@ func NewHelmDriver(resource *models.Resource, opts *drivers.SharedDriverOpts) (d
 		logger:      opts.Logger,
 	}
 
-	source, err := GetSource(resource.Source)
+	source, err := GetSource(resource.Source, opts.BaseDir)
 
 	if err != nil {
 		return nil, err
 	}
 
+	source.Cache = &loader.Cache{
+		Dir:      opts.CacheDir,
+		IndexTTL: opts.ChartIndexTTL,
+	}
+
 	driver.source = source
 
 	target, err := GetTarget(resource.Target, opts.Logger)
@@ -39,22 +56,74 @@ func NewHelmDriver(resource *models.Resource, opts *drivers.SharedDriverOpts) (d
 	return driver, nil
 }
 
-func (d *Driver) ShouldApply(resource *models.Resource) bool {
-	return true
+// ShouldApply returns false if the live release was deployed from the same chart with
+// the same values. In that case, the output is set from the live release.
+func (d *Driver) ShouldApply(ctx context.Context, resource *models.Resource) bool {
+	config, err := d.getValues(ctx, resource)
+
+	if err != nil {
+		return true
+	}
+
+	isUpToDate, rel, err := d.target.agent.IsUpToDate(ctx, &ApplyOpts{
+		Config: config,
+		Target: d.target,
+		Source: d.source,
+	})
+
+	if err != nil {
+		d.logger.Warn().Err(err).Msg("could not detect changes, applying resource")
+		return true
+	} else if !isUpToDate {
+		return true
+	}
+
+	output, outputMask, err := d.getOutput(ctx, rel, true)
+
+	if err != nil {
+		d.logger.Warn().Err(err).Msg("could not get the release output, applying resource")
+		return true
+	}
+
+	d.output, d.outputMask = output, outputMask
+
+	return false
 }
 
-func (d *Driver) Apply(resource *models.Resource) (*models.Resource, error) {
-	config, err := drivers.ConstructConfig(&drivers.ConstructConfigOpts{
-		RawConf:      resource.Config,
-		LookupTable:  *d.lookupTable,
-		Dependencies: resource.Dependencies,
+func (d *Driver) Apply(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	config, err := d.getValues(ctx, resource)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := d.target.agent.Apply(ctx, &ApplyOpts{
+		Config: config,
+		Target: d.target,
+		Source: d.source,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	rel, err := d.target.agent.Apply(&ApplyOpts{
+	d.output, d.outputMask, err = d.getOutput(ctx, rel, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (d *Driver) Plan(ctx context.Context, resource *models.Resource) (*drivers.Plan, error) {
+	config, err := d.getValues(ctx, resource)
+
+	if err != nil {
+		return nil, err
+	}
+
+	plan, rel, err := d.target.agent.Plan(ctx, &ApplyOpts{
 		Config: config,
 		Target: d.target,
 		Source: d.source,
@@ -64,12 +133,142 @@ func (d *Driver) Apply(resource *models.Resource) (*models.Resource, error) {
 		return nil, err
 	}
 
-	d.output = rel.Config
+	d.output, d.outputMask, err = d.getOutput(ctx, rel, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// getValues layers the source's values files and the constructed config, with the config
+// taking precedence
+func (d *Driver) getValues(ctx context.Context, resource *models.Resource) (map[string]interface{}, error) {
+	values, err := d.source.readValuesFiles()
+
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
+		RawConf:      resource.Config,
+		RawConfMask:  resource.ConfigMask,
+		LookupTable:  *d.lookupTable,
+		Dependencies: resource.Dependencies,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	values = objutils.CoalesceValues(values, config)
+
+	if err := checkReservedValues(values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func (d *Driver) Delete(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	err := d.target.agent.Delete(ctx, d.target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d.output = nil
+	d.outputMask = nil
 
 	return resource, nil
 }
 
-// Output returns the created Kubernetes configuration, including status section.
-func (d *Driver) Output() (map[string]interface{}, error) {
+// Checkpoint records the revision of the release, so that it can be restored by Rollback
+func (d *Driver) Checkpoint(ctx context.Context, resource *models.Resource) error {
+	revision, err := d.target.agent.GetRevision(ctx, d.target)
+
+	if err != nil {
+		return err
+	}
+
+	d.revision = revision
+	d.checkpointed = true
+
+	return nil
+}
+
+// Rollback rolls the release back to the revision recorded by Checkpoint, or
+// uninstalls the release if it did not exist before it was applied.
+func (d *Driver) Rollback(ctx context.Context, current, previous *models.Resource) error {
+	if !d.checkpointed {
+		return fmt.Errorf("no checkpoint was recorded for resource %s", current.Name)
+	}
+
+	rel, err := d.target.agent.Rollback(ctx, d.target, d.revision)
+
+	if err != nil {
+		return err
+	}
+
+	d.output = nil
+	d.outputMask = nil
+
+	if rel != nil {
+		d.output, d.outputMask, err = d.getOutput(ctx, rel, true)
+	}
+
+	return err
+}
+
+// Wait waits for the objects in the release manifest to become ready
+func (d *Driver) Wait(ctx context.Context, resource *models.Resource) error {
+	err := d.target.agent.loadRelease(ctx, d.source, d.target)
+
+	if err != nil {
+		return fmt.Errorf("error getting the release: %v", err)
+	}
+
+	rel := d.target.agent.release
+
+	objects, err := kubernetes.ParseManifests([]byte(rel.Manifest))
+
+	if err != nil {
+		return fmt.Errorf("error parsing the release manifest: %v", err)
+	}
+
+	// objects in the manifest which do not set a namespace are installed in the
+	// release namespace
+	target := &kubernetes.Target{
+		Namespace: rel.Namespace,
+	}
+
+	allApplyOpts := make([]*kubernetes.ApplyOpts, 0)
+
+	for _, obj := range objects {
+		allApplyOpts = append(allApplyOpts, &kubernetes.ApplyOpts{
+			Base:   obj,
+			Target: target,
+		})
+	}
+
+	_, err = d.target.agent.K8sAgent.Wait(ctx, allApplyOpts, resource.Wait)
+
+	// refresh the output, so that it reflects the status of the ready objects
+	if output, outputMask, outputErr := d.getOutput(ctx, rel, true); outputErr == nil {
+		d.output, d.outputMask = output, outputMask
+	}
+
+	return err
+}
+
+// Output returns the values passed to the release, along with the release metadata, the
+// computed values and the objects in the release manifest.
+func (d *Driver) Output(ctx context.Context) (map[string]interface{}, error) {
 	return d.output, nil
 }
+
+// SensitiveOutput marks the data of Secrets in the release manifest as sensitive
+func (d *Driver) SensitiveOutput(ctx context.Context) (map[string]interface{}, error) {
+	return d.outputMask, nil
+}
@@ -0,0 +1,158 @@
+package loader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultIndexTTL is the duration that a cached repository index is used for before it
+// is downloaded again
+const DefaultIndexTTL = 5 * time.Minute
+
+// cacheSubdir is the directory inside the cache directory which stores Helm data
+const cacheSubdir = "helm"
+
+// Cache stores repository indexes and chart archives on disk. Charts are keyed by the
+// repository URL, chart name and chart version, and are only read from the cache if they
+// match the digest in the repository index or OCI manifest. Indexes and OCI manifests are
+// re-downloaded once they are older than IndexTTL. If they cannot be downloaded, the
+// cached copy is used regardless of its age, so that cached charts can be loaded offline.
+//
+// A nil Cache, or a Cache without a directory, does not cache anything.
+type Cache struct {
+	Dir string
+
+	// IndexTTL is the duration that a cached index is used for. If it is 0, indexes are
+	// downloaded on every load, and the cache is only used if the download fails.
+	IndexTTL time.Duration
+}
+
+// ClearCache removes every index and chart stored by the Helm loader in a cache directory
+func ClearCache(dir string) error {
+	err := os.RemoveAll(filepath.Join(dir, cacheSubdir))
+
+	if err != nil {
+		return fmt.Errorf("error clearing Helm cache: %v", err)
+	}
+
+	return nil
+}
+
+func (c *Cache) enabled() bool {
+	return c != nil && c.Dir != ""
+}
+
+// getIndex returns the cached index stored under the key, and whether the index is
+// younger than the index TTL
+func (c *Cache) getIndex(key string) ([]byte, bool) {
+	if !c.enabled() {
+		return nil, false
+	}
+
+	path := c.getPath("indexes", key, ".yaml")
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, false
+	}
+
+	return data, time.Since(info.ModTime()) < c.IndexTTL
+}
+
+func (c *Cache) setIndex(key string, data []byte) error {
+	if !c.enabled() {
+		return nil
+	}
+
+	return writeFileAtomic(c.getPath("indexes", key, ".yaml"), data)
+}
+
+// getChart returns the cached chart archive stored under the key, if it matches the
+// digest. If the digest is empty, the cached archive is always returned.
+func (c *Cache) getChart(key, digest string) ([]byte, bool) {
+	if !c.enabled() {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(c.getPath("charts", key, ".tgz"))
+
+	if err != nil {
+		return nil, false
+	}
+
+	if digest != "" && verifyDigest(data, digest) != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+func (c *Cache) setChart(key string, data []byte) error {
+	if !c.enabled() {
+		return nil
+	}
+
+	return writeFileAtomic(c.getPath("charts", key, ".tgz"), data)
+}
+
+// getPath returns the path of a cached file. Keys are hashed, since they contain URLs
+// which are not valid file names.
+func (c *Cache) getPath(kind, key, ext string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return filepath.Join(c.Dir, cacheSubdir, kind, hex.EncodeToString(sum[:])+ext)
+}
+
+// getChartKey returns the cache key of a chart
+func getChartKey(repoURL, chartName, chartVersion string) string {
+	return strings.Join([]string{repoURL, chartName, chartVersion}, "\n")
+}
+
+// writeFileAtomic writes a file through a temporary file in the same directory, so that
+// concurrent loads never read a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+
+	if err != nil {
+		return fmt.Errorf("error creating cache directory: %v", err)
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+
+	if err != nil {
+		return fmt.Errorf("error writing to cache: %v", err)
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(data)
+
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("error writing to cache: %v", err)
+	}
+
+	err = os.Rename(tmpFile.Name(), path)
+
+	if err != nil {
+		return fmt.Errorf("error writing to cache: %v", err)
+	}
+
+	return nil
+}
@@ -2,6 +2,9 @@ package loader
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -15,28 +18,77 @@ import (
 	chartloader "helm.sh/helm/v3/pkg/chart/loader"
 )
 
-// BasicAuthClient is just a username/password to set on requests
+// BasicAuthClient is a username/password to set on requests, along with the TLS options
+// used to connect to the chart repository
 type BasicAuthClient struct {
 	Username string
 	Password string
+
+	// CAFile is the path to a PEM-encoded CA bundle which is trusted in addition to the
+	// system certificate pool
+	CAFile string
+
+	// InsecureSkipTLSVerify disables verification of the repository's certificate
+	InsecureSkipTLSVerify bool
 }
 
-// LoadRepoIndex uses an http request to get the index file and loads it
-func LoadRepoIndex(client *BasicAuthClient, repoURL string) (*repo.IndexFile, error) {
-	trimmedRepoURL := strings.TrimSuffix(strings.TrimSpace(repoURL), "/")
-	indexURL := trimmedRepoURL + "/index.yaml"
+// getHTTPClient returns an HTTP client which uses the client's TLS options
+func (c *BasicAuthClient) getHTTPClient() (*http.Client, error) {
+	if c.CAFile == "" && !c.InsecureSkipTLSVerify {
+		return http.DefaultClient, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipTLSVerify,
+	}
+
+	if c.CAFile != "" {
+		caBytes, err := ioutil.ReadFile(c.CAFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %v", err)
+		}
+
+		certPool, err := x509.SystemCertPool()
+
+		if err != nil {
+			certPool = x509.NewCertPool()
+		}
+
+		if !certPool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("CA file %s does not contain any PEM-encoded certificates", c.CAFile)
+		}
+
+		tlsConfig.RootCAs = certPool
+	}
 
-	req, err := http.NewRequest("GET", indexURL, nil)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{
+		Transport: transport,
+	}, nil
+}
+
+// get performs a GET request with the client's credentials, and returns the response body
+func (c *BasicAuthClient) get(ctx context.Context, reqURL string) ([]byte, error) {
+	httpClient, err := c.getHTTPClient()
 
 	if err != nil {
 		return nil, err
 	}
 
-	if client.Username != "" {
-		req.SetBasicAuth(client.Username, client.Password)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+
+	if err != nil {
+		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := httpClient.Do(req)
 
 	if err != nil {
 		return nil, err
@@ -44,13 +96,28 @@ func LoadRepoIndex(client *BasicAuthClient, repoURL string) (*repo.IndexFile, er
 
 	defer resp.Body.Close()
 
-	data, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request to %s failed with status %s", reqURL, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// LoadRepoIndex uses an http request to get the index file and loads it. If the cache
+// contains an index which is younger than the index TTL, the cached index is used. If the
+// index cannot be downloaded, an older cached index is used instead.
+func LoadRepoIndex(ctx context.Context, client *BasicAuthClient, cache *Cache, repoURL string) (*repo.IndexFile, error) {
+	trimmedRepoURL := strings.TrimSuffix(strings.TrimSpace(repoURL), "/")
+	indexURL := trimmedRepoURL + "/index.yaml"
+
+	data, err := getCachedIndex(ctx, cache, indexURL, func() ([]byte, error) {
+		return client.get(ctx, indexURL)
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	// index not found in the cache, parse it
 	index := &repo.IndexFile{}
 	err = yaml.Unmarshal(data, index)
 
@@ -63,14 +130,43 @@ func LoadRepoIndex(client *BasicAuthClient, repoURL string) (*repo.IndexFile, er
 	return index, nil
 }
 
+// getCachedIndex returns the index stored in the cache under the key if it is fresh.
+// Otherwise, the index is downloaded and written to the cache, falling back to a stale
+// cached index if the download fails.
+func getCachedIndex(ctx context.Context, cache *Cache, key string, download func() ([]byte, error)) ([]byte, error) {
+	cached, isFresh := cache.getIndex(key)
+
+	if isFresh {
+		return cached, nil
+	}
+
+	data, err := download()
+
+	if err != nil {
+		// cancellation is reported instead of falling back to the cache
+		if ctx.Err() != nil || cached == nil {
+			return nil, err
+		}
+
+		return cached, nil
+	}
+
+	// the cache is best-effort, so failures to write to it are ignored
+	cache.setIndex(key, data)
+
+	return data, nil
+}
+
 // LoadRepoIndexPublic loads an index file from a remote public Helm repo
-func LoadRepoIndexPublic(repoURL string) (*repo.IndexFile, error) {
-	return LoadRepoIndex(&BasicAuthClient{}, repoURL)
+func LoadRepoIndexPublic(ctx context.Context, cache *Cache, repoURL string) (*repo.IndexFile, error) {
+	return LoadRepoIndex(ctx, &BasicAuthClient{}, cache, repoURL)
 }
 
-// LoadChart uses an http request to fetch a chart from a remote Helm repo
-func LoadChart(client *BasicAuthClient, repoURL, chartName, chartVersion string) (*chart.Chart, error) {
-	repoIndex, err := LoadRepoIndex(client, repoURL)
+// LoadChart uses an http request to fetch a chart from a remote Helm repo. If the cache
+// contains the chart and it matches the digest in the repo index, the cached chart is
+// loaded instead. Downloaded charts are verified against the digest in the repo index.
+func LoadChart(ctx context.Context, client *BasicAuthClient, cache *Cache, repoURL, chartName, chartVersion string) (*chart.Chart, error) {
+	repoIndex, err := LoadRepoIndex(ctx, client, cache, repoURL)
 
 	if err != nil {
 		return nil, err
@@ -85,6 +181,12 @@ func LoadChart(client *BasicAuthClient, repoURL, chartName, chartVersion string)
 	}
 
 	trimmedRepoURL := strings.TrimSuffix(strings.TrimSpace(repoURL), "/")
+	key := getChartKey(trimmedRepoURL, chartName, cv.Version)
+
+	if data, ok := cache.getChart(key, cv.Digest); ok {
+		return chartloader.LoadArchive(bytes.NewReader(data))
+	}
+
 	chartURL := cv.URLs[0]
 
 	if !isValidURL(chartURL) {
@@ -92,40 +194,29 @@ func LoadChart(client *BasicAuthClient, repoURL, chartName, chartVersion string)
 	}
 
 	// download tgz
-	req, err := http.NewRequest("GET", chartURL, nil)
+	data, err := client.get(ctx, chartURL)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if client.Username != "" {
-		req.SetBasicAuth(client.Username, client.Password)
-	}
+	if cv.Digest != "" {
+		err = verifyDigest(data, cv.Digest)
 
-	resp, err := http.DefaultClient.Do(req)
-
-	if err != nil {
-		return nil, err
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	defer resp.Body.Close()
-
-	data, err := ioutil.ReadAll(resp.Body)
-
-	if err != nil {
-		return nil, err
-	}
+	cache.setChart(key, data)
 
 	return chartloader.LoadArchive(bytes.NewReader(data))
 }
 
 // LoadChartPublic returns a Helm3 (v2) chart from a remote public repo.
 // If chartVersion is an empty string, the most stable latest version is found.
-//
-// TODO: this is an expensive operation, so after retrieving the digest from the
-// repo index, this should check the digest in the cache
-func LoadChartPublic(repoURL, chartName, chartVersion string) (*chart.Chart, error) {
-	return LoadChart(&BasicAuthClient{}, repoURL, chartName, chartVersion)
+func LoadChartPublic(ctx context.Context, cache *Cache, repoURL, chartName, chartVersion string) (*chart.Chart, error) {
+	return LoadChart(ctx, &BasicAuthClient{}, cache, repoURL, chartName, chartVersion)
 }
 
 // Helper method to test if chart repo URL is valid, or is a path. Chartmuseum saves URLs
@@ -0,0 +1,242 @@
+package loader_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/porter-dev/switchboard/pkg/drivers/helm/loader"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func getTestChartArchive(t *testing.T) []byte {
+	dir := t.TempDir()
+
+	path, err := chartutil.Save(&chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: chart.APIVersionV2,
+			Name:       "web",
+			Version:    "0.1.0",
+		},
+	}, dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// writeCAFile writes the certificate of a test server to a file, and returns the path
+func writeCAFile(t *testing.T, server *httptest.Server) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+
+	certBytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	})
+
+	err := ioutil.WriteFile(path, certBytes, 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadChartBasicAuth(t *testing.T) {
+	archive := getTestChartArchive(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/index.yaml":
+			fmt.Fprint(w, "apiVersion: v1\nentries:\n  web:\n  - name: web\n    version: 0.1.0\n    urls:\n    - web-0.1.0.tgz\n")
+		case "/web-0.1.0.tgz":
+			w.Write(archive)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	defer server.Close()
+
+	ch, err := loader.LoadChart(context.Background(), &loader.BasicAuthClient{
+		Username: "user",
+		Password: "pass",
+		CAFile:   writeCAFile(t, server),
+	}, nil, server.URL, "web", "0.1.0")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "web", ch.Name())
+
+	_, err = loader.LoadChart(context.Background(), &loader.BasicAuthClient{
+		CAFile: writeCAFile(t, server),
+	}, nil, server.URL, "web", "0.1.0")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "401 Unauthorized")
+}
+
+func TestLoadOCIChartTokenAuth(t *testing.T) {
+	archive := getTestChartArchive(t)
+	sum := sha256.Sum256(archive)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	var server *httptest.Server
+
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			assert.Equal(t, "repository:charts/web:pull", r.URL.Query().Get("scope"))
+
+			json.NewEncoder(w).Encode(map[string]string{"token": "test-token"})
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="test",scope="repository:charts/web:pull"`,
+				server.URL,
+			))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/charts/web/manifests/0.1.0_build.1":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"schemaVersion": 2,
+				"layers": []map[string]interface{}{{
+					"mediaType": "application/vnd.cncf.helm.chart.content.v1.tar+gzip",
+					"digest":    digest,
+					"size":      len(archive),
+				}},
+			})
+		case "/v2/charts/web/blobs/" + digest:
+			w.Write(archive)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	defer server.Close()
+
+	repoURL := "oci://" + strings.TrimPrefix(server.URL, "https://") + "/charts"
+
+	ch, err := loader.LoadOCIChart(context.Background(), &loader.BasicAuthClient{
+		Username:              "user",
+		Password:              "pass",
+		InsecureSkipTLSVerify: true,
+	}, nil, repoURL, "web", "0.1.0+build.1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "web", ch.Name())
+}
+
+func TestLoadOCIChartRequiresVersion(t *testing.T) {
+	_, err := loader.LoadOCIChart(context.Background(), &loader.BasicAuthClient{}, nil, "oci://registry.example.com/charts", "web", "")
+
+	assert.EqualError(t, err, "a chart version must be set for charts in OCI registries")
+}
+
+// newTestRepo serves a repository containing the web chart, and counts the requests
+// made to the server
+func newTestRepo(t *testing.T, archive []byte, digest string, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+
+		switch r.URL.Path {
+		case "/index.yaml":
+			fmt.Fprintf(w, "apiVersion: v1\nentries:\n  web:\n  - name: web\n    version: 0.1.0\n    digest: %s\n    urls:\n    - web-0.1.0.tgz\n", digest)
+		case "/web-0.1.0.tgz":
+			w.Write(archive)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestLoadChartCache(t *testing.T) {
+	archive := getTestChartArchive(t)
+	sum := sha256.Sum256(archive)
+
+	requests := 0
+	server := newTestRepo(t, archive, hex.EncodeToString(sum[:]), &requests)
+
+	cache := &loader.Cache{
+		Dir:      t.TempDir(),
+		IndexTTL: time.Hour,
+	}
+
+	_, err := loader.LoadChartPublic(context.Background(), cache, server.URL, "web", "0.1.0")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	// the index and chart are both read from the cache
+	_, err = loader.LoadChartPublic(context.Background(), cache, server.URL, "web", "0.1.0")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	// with an expired index, the cached index and chart are used when the repository
+	// cannot be reached
+	server.Close()
+	cache.IndexTTL = 0
+
+	ch, err := loader.LoadChartPublic(context.Background(), cache, server.URL, "web", "0.1.0")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "web", ch.Name())
+
+	// after clearing the cache, the chart cannot be loaded
+	err = loader.ClearCache(cache.Dir)
+
+	assert.NoError(t, err)
+
+	_, err = loader.LoadChartPublic(context.Background(), cache, server.URL, "web", "0.1.0")
+
+	assert.Error(t, err)
+}
+
+func TestLoadChartDigestMismatch(t *testing.T) {
+	archive := getTestChartArchive(t)
+	sum := sha256.Sum256([]byte("not the chart"))
+
+	requests := 0
+	server := newTestRepo(t, archive, hex.EncodeToString(sum[:]), &requests)
+
+	defer server.Close()
+
+	_, err := loader.LoadChartPublic(context.Background(), &loader.Cache{Dir: t.TempDir()}, server.URL, "web", "0.1.0")
+
+	assert.EqualError(t, err, fmt.Sprintf("digest of downloaded chart does not match %s", hex.EncodeToString(sum[:])))
+}
@@ -0,0 +1,317 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	chartloader "helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// OCIScheme is the prefix of chart repository URLs which point to an OCI registry
+const OCIScheme = "oci://"
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+	// chartLayerMediaType is the media type of the chart archive pushed by Helm. Charts
+	// pushed by older versions of Helm use legacyChartLayerMediaType.
+	chartLayerMediaType       = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	legacyChartLayerMediaType = "application/tar+gzip"
+)
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// LoadOCIChart pulls a chart from an OCI registry. The repository URL has the form
+// oci://registry/path, and the chart is read from registry/path/chartName, tagged with
+// the chart version. Manifests are cached in the same way as repository indexes, and
+// cached charts are used if they match the digest in the manifest.
+func LoadOCIChart(ctx context.Context, client *BasicAuthClient, cache *Cache, repoURL, chartName, chartVersion string) (*chart.Chart, error) {
+	if !strings.HasPrefix(repoURL, OCIScheme) {
+		return nil, fmt.Errorf("OCI repository %s must start with %s", repoURL, OCIScheme)
+	}
+
+	if chartVersion == "" {
+		return nil, fmt.Errorf("a chart version must be set for charts in OCI registries")
+	}
+
+	ref := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(repoURL), OCIScheme), "/") + "/" + chartName
+	refParts := strings.SplitN(ref, "/", 2)
+
+	registry := &ociRegistry{
+		client:     client,
+		host:       refParts[0],
+		repository: refParts[1],
+	}
+
+	// OCI tags cannot contain "+", so Helm replaces it with "_" when pushing charts
+	tag := strings.ReplaceAll(chartVersion, "+", "_")
+
+	manifestBytes, err := getCachedIndex(ctx, cache, OCIScheme+ref+":"+tag, func() ([]byte, error) {
+		return registry.get(ctx, "manifests/"+tag, ociManifestMediaType)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting manifest for %s:%s: %v", ref, tag, err)
+	}
+
+	manifest := &ociManifest{}
+
+	err = json.Unmarshal(manifestBytes, manifest)
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest for %s:%s: %v", ref, tag, err)
+	}
+
+	var chartLayer *ociDescriptor
+
+	for i, layer := range manifest.Layers {
+		if layer.MediaType == chartLayerMediaType || layer.MediaType == legacyChartLayerMediaType {
+			chartLayer = &manifest.Layers[i]
+			break
+		}
+	}
+
+	if chartLayer == nil {
+		return nil, fmt.Errorf("%s:%s is not a Helm chart", ref, tag)
+	}
+
+	key := getChartKey(OCIScheme+ref, chartName, chartVersion)
+
+	if data, ok := cache.getChart(key, chartLayer.Digest); ok {
+		return chartloader.LoadArchive(bytes.NewReader(data))
+	}
+
+	data, err := registry.get(ctx, "blobs/"+chartLayer.Digest, "")
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting chart archive for %s:%s: %v", ref, tag, err)
+	}
+
+	err = verifyDigest(data, chartLayer.Digest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cache.setChart(key, data)
+
+	return chartloader.LoadArchive(bytes.NewReader(data))
+}
+
+// verifyDigest returns an error if the data does not match a sha256 digest. The digest
+// is either prefixed with the algorithm, as in OCI manifests, or is a plain hex digest,
+// as in repository indexes.
+func verifyDigest(data []byte, digest string) error {
+	hexDigest := strings.TrimPrefix(digest, "sha256:")
+
+	if strings.Contains(hexDigest, ":") {
+		return fmt.Errorf("unsupported digest algorithm in %s", digest)
+	}
+
+	sum := sha256.Sum256(data)
+
+	if hex.EncodeToString(sum[:]) != strings.ToLower(hexDigest) {
+		return fmt.Errorf("digest of downloaded chart does not match %s", digest)
+	}
+
+	return nil
+}
+
+// ociRegistry reads from a repository in an OCI registry, using the registry's token
+// authentication if it is required
+type ociRegistry struct {
+	client     *BasicAuthClient
+	host       string
+	repository string
+	token      string
+}
+
+func (r *ociRegistry) get(ctx context.Context, path, accept string) ([]byte, error) {
+	reqURL := fmt.Sprintf("https://%s/v2/%s/%s", r.host, r.repository, path)
+
+	resp, err := r.do(ctx, reqURL, accept)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// if the registry requires authentication, authenticate and retry the request
+	if resp.StatusCode == http.StatusUnauthorized && r.token == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		err = r.authenticate(ctx, challenge)
+
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err = r.do(ctx, reqURL, accept)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request to %s failed with status %s", reqURL, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (r *ociRegistry) do(ctx context.Context, reqURL, accept string) (*http.Response, error) {
+	httpClient, err := r.client.getHTTPClient()
+
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	} else if r.client.Username != "" {
+		req.SetBasicAuth(r.client.Username, r.client.Password)
+	}
+
+	return httpClient.Do(req)
+}
+
+// authenticate requests a bearer token from the realm in the registry's challenge. The
+// registry's credentials are sent to the token endpoint if they are set.
+func (r *ociRegistry) authenticate(ctx context.Context, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+
+	if !strings.EqualFold(scheme, "bearer") {
+		return fmt.Errorf("registry %s requires authentication", r.host)
+	}
+
+	realm, err := url.Parse(params["realm"])
+
+	if err != nil || realm.Host == "" {
+		return fmt.Errorf("registry %s returned an invalid token realm", r.host)
+	}
+
+	query := realm.Query()
+
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+
+	scope, ok := params["scope"]
+
+	if !ok {
+		scope = fmt.Sprintf("repository:%s:pull", r.repository)
+	}
+
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	data, err := r.client.get(ctx, realm.String())
+
+	if err != nil {
+		return fmt.Errorf("error getting token for registry %s: %v", r.host, err)
+	}
+
+	tokenResp := &struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+
+	err = json.Unmarshal(data, tokenResp)
+
+	if err != nil {
+		return fmt.Errorf("error parsing token for registry %s: %v", r.host, err)
+	}
+
+	r.token = tokenResp.Token
+
+	if r.token == "" {
+		r.token = tokenResp.AccessToken
+	}
+
+	if r.token == "" {
+		return fmt.Errorf("registry %s did not return a token", r.host)
+	}
+
+	return nil
+}
+
+// parseChallenge parses a WWW-Authenticate header of the form
+// Bearer realm="...",service="...",scope="..."
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	rest := parts[1]
+
+	for rest != "" {
+		eqIndex := strings.Index(rest, "=")
+
+		if eqIndex == -1 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(rest[:eqIndex]))
+		rest = strings.TrimSpace(rest[eqIndex+1:])
+
+		var val string
+
+		if strings.HasPrefix(rest, "\"") {
+			endIndex := strings.Index(rest[1:], "\"")
+
+			if endIndex == -1 {
+				break
+			}
+
+			val = rest[1 : endIndex+1]
+			rest = rest[endIndex+2:]
+		} else {
+			endIndex := strings.Index(rest, ",")
+
+			if endIndex == -1 {
+				endIndex = len(rest)
+			}
+
+			val = rest[:endIndex]
+			rest = rest[endIndex:]
+		}
+
+		params[key] = val
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+
+	return parts[0], params
+}
@@ -0,0 +1,148 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/porter-dev/switchboard/pkg/drivers/kubernetes"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// metadataKey is the key of the output which contains the release metadata. It is
+// prefixed, so that it does not collide with the values of existing charts. Values with
+// the same key cannot be passed to the release, since they would be hidden in the output.
+const metadataKey = "__switchboard"
+
+// getOutput returns the output of a release, along with the mask of its sensitive values.
+// The values passed to the release are set at the top level, and the metadataKey contains
+// the following fields:
+//
+// - release: the release metadata
+// - values: the values computed from the chart's default values and the passed values
+// - objects: the objects in the rendered manifest, keyed by kind/namespace/name
+//
+// If live is set, objects are read from the cluster so that their status is included.
+// Objects which cannot be read are output as they appear in the manifest. The data of
+// Secrets in the objects is sensitive.
+func (d *Driver) getOutput(ctx context.Context, rel *release.Release, live bool) (map[string]interface{}, map[string]interface{}, error) {
+	if err := checkReservedValues(rel.Config); err != nil {
+		return nil, nil, err
+	}
+
+	res := make(map[string]interface{})
+
+	for key, val := range rel.Config {
+		res[key] = val
+	}
+
+	values, err := chartutil.CoalesceValues(rel.Chart, rel.Config)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("error computing release values: %v", err)
+	}
+
+	objects, err := d.getManifestObjects(ctx, rel, live)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res[metadataKey] = map[string]interface{}{
+		"release": getReleaseOutput(rel),
+		"values":  map[string]interface{}(values),
+		"objects": kubernetes.GetObjectsOutput(objects, false),
+	}
+
+	var mask map[string]interface{}
+
+	if objectsMask := kubernetes.GetObjectsOutputMask(objects, false); objectsMask != nil {
+		mask = map[string]interface{}{
+			metadataKey: map[string]interface{}{
+				"objects": objectsMask,
+			},
+		}
+	}
+
+	return res, mask, nil
+}
+
+// checkReservedValues returns an error if the values set the metadataKey
+func checkReservedValues(values map[string]interface{}) error {
+	if _, ok := values[metadataKey]; ok {
+		return fmt.Errorf("the value %s cannot be set, since it is reserved for the release metadata in the output", metadataKey)
+	}
+
+	return nil
+}
+
+func getReleaseOutput(rel *release.Release) map[string]interface{} {
+	res := map[string]interface{}{
+		"name":      rel.Name,
+		"namespace": rel.Namespace,
+		"revision":  rel.Version,
+	}
+
+	if rel.Info != nil {
+		res["status"] = rel.Info.Status.String()
+		res["notes"] = rel.Info.Notes
+	}
+
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		res["chart"] = rel.Chart.Metadata.Name
+		res["chart_version"] = rel.Chart.Metadata.Version
+		res["app_version"] = rel.Chart.Metadata.AppVersion
+	}
+
+	return res
+}
+
+// getManifestObjects returns the objects in the release manifest. Objects without a
+// namespace are assigned the release namespace if they are namespace-scoped, so that
+// they are keyed in the same way as live objects.
+func (d *Driver) getManifestObjects(ctx context.Context, rel *release.Release, live bool) ([]map[string]interface{}, error) {
+	objects, err := kubernetes.ParseManifests([]byte(rel.Manifest))
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the release manifest: %v", err)
+	}
+
+	k8sAgent := d.target.agent.K8sAgent
+	target := &kubernetes.Target{
+		Namespace: rel.Namespace,
+	}
+
+	for i, obj := range objects {
+		if live {
+			liveObj, err := k8sAgent.Get(ctx, &kubernetes.ApplyOpts{
+				Base:   obj,
+				Target: target,
+			})
+
+			if err != nil {
+				d.logger.Warn().Err(err).Msg("could not get the live status of a release object")
+			} else if liveObj != nil {
+				objects[i] = liveObj
+				continue
+			}
+		}
+
+		if isNamespaced, err := k8sAgent.IsNamespaced(obj); err == nil && isNamespaced {
+			setDefaultNamespace(obj, rel.Namespace)
+		}
+	}
+
+	return objects, nil
+}
+
+func setDefaultNamespace(obj map[string]interface{}, namespace string) {
+	metadata, ok := obj["metadata"].(map[string]interface{})
+
+	if !ok {
+		return
+	}
+
+	if currNamespace, _ := metadata["namespace"].(string); currNamespace == "" {
+		metadata["namespace"] = namespace
+	}
+}
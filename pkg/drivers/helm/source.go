@@ -1,18 +1,31 @@
 package helm
 
-import "github.com/porter-dev/switchboard/utils/objutils"
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/porter-dev/switchboard/pkg/drivers/helm/loader"
+	"github.com/porter-dev/switchboard/utils/objutils"
+	"sigs.k8s.io/yaml"
+)
 
 type SourceKind string
 
 const (
 	SourceKindRepository SourceKind = "repository"
 	SourceKindLocal      SourceKind = "local"
+	SourceKindOCI        SourceKind = "oci"
 )
 
 type SourceLocal struct {
 	Path string
 }
 
+// SourceRepository is a chart in a chart repository, or in an OCI registry if the
+// source kind is oci
 type SourceRepository struct {
 	ChartRepoURL string
 	ChartName    string
@@ -23,9 +36,28 @@ type Source struct {
 	*SourceRepository
 
 	Kind SourceKind
+
+	// Client contains the credentials and TLS options used to reach the repository
+	Client *loader.BasicAuthClient
+
+	// ValuesFiles are paths to values files, which are layered in order beneath the
+	// resource config
+	ValuesFiles []string
+
+	// Cache stores downloaded indexes and charts. If it is nil, charts are downloaded
+	// on every load.
+	Cache *loader.Cache
+}
+
+// sourceCredentials is the format of a credentials file referenced by a source
+type sourceCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
-func GetSource(genericSource map[string]interface{}) (*Source, error) {
+// GetSource parses a Helm source. Files referenced by the source are resolved relative
+// to the base directory.
+func GetSource(genericSource map[string]interface{}, baseDir string) (*Source, error) {
 	res := &Source{}
 	var err error
 
@@ -38,6 +70,12 @@ func GetSource(genericSource map[string]interface{}) (*Source, error) {
 
 	res.Kind = SourceKind(kind)
 
+	res.ValuesFiles, err = getValuesFiles(genericSource, baseDir)
+
+	if err != nil {
+		return nil, err
+	}
+
 	switch SourceKind(kind) {
 	case SourceKindLocal:
 		res.SourceLocal = &SourceLocal{}
@@ -47,7 +85,7 @@ func GetSource(genericSource map[string]interface{}) (*Source, error) {
 		if err != nil {
 			return nil, err
 		}
-	case SourceKindRepository:
+	case SourceKindRepository, SourceKindOCI:
 		res.SourceRepository = &SourceRepository{}
 		res.SourceRepository.ChartName, err = objutils.GetNestedString(genericSource, "chart_name")
 
@@ -66,7 +104,152 @@ func GetSource(genericSource map[string]interface{}) (*Source, error) {
 		if err != nil {
 			return nil, err
 		}
+
+		isOCI := strings.HasPrefix(res.SourceRepository.ChartRepoURL, loader.OCIScheme)
+
+		if res.Kind == SourceKindOCI && !isOCI {
+			return nil, fmt.Errorf("source parameter \"chart_repository\" must start with %s when using \"oci\" kind", loader.OCIScheme)
+		} else if res.Kind == SourceKindRepository && isOCI {
+			return nil, fmt.Errorf("source parameter \"chart_repository\" is an OCI registry, use the \"oci\" kind instead")
+		}
+
+		res.Client, err = getSourceClient(genericSource, baseDir)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// getValuesFiles reads the optional list of values files, resolved relative to the base
+// directory
+func getValuesFiles(genericSource map[string]interface{}, baseDir string) ([]string, error) {
+	rawFiles, ok := genericSource["values_files"]
+
+	if !ok || rawFiles == nil {
+		return nil, nil
+	}
+
+	files, ok := rawFiles.([]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("source parameter \"values_files\" must be a list of paths")
+	}
+
+	res := make([]string, 0, len(files))
+
+	for _, file := range files {
+		path, ok := file.(string)
+
+		if !ok || path == "" {
+			return nil, fmt.Errorf("source parameter \"values_files\" must be a list of paths")
+		}
+
+		res = append(res, resolvePath(path, baseDir))
+	}
+
+	return res, nil
+}
+
+// readValuesFiles reads the values files of the source, and layers them in order. Values
+// in later files take precedence.
+func (s *Source) readValuesFiles() (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+
+	for _, path := range s.ValuesFiles {
+		fileBytes, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading values file %s: %v", path, err)
+		}
+
+		values := make(map[string]interface{})
+
+		err = yaml.Unmarshal(fileBytes, &values)
+
+		if err != nil {
+			return nil, fmt.Errorf("error parsing values file %s: %v", path, err)
+		}
+
+		res = objutils.CoalesceValues(res, values)
 	}
 
 	return res, nil
 }
+
+// getSourceClient reads the credentials and TLS options of a repository source.
+// Credentials are read from environment variables named by "username_env" and
+// "password_env", or from a yaml or json file referenced by "credentials_file".
+func getSourceClient(genericSource map[string]interface{}, baseDir string) (*loader.BasicAuthClient, error) {
+	res := &loader.BasicAuthClient{}
+
+	usernameEnv, _ := objutils.GetNestedString(genericSource, "auth", "username_env")
+	passwordEnv, _ := objutils.GetNestedString(genericSource, "auth", "password_env")
+	credentialsFile, _ := objutils.GetNestedString(genericSource, "auth", "credentials_file")
+
+	if credentialsFile != "" && (usernameEnv != "" || passwordEnv != "") {
+		return nil, fmt.Errorf("source auth can be read from \"credentials_file\" or environment variables, but not both")
+	}
+
+	if usernameEnv != "" {
+		res.Username = os.Getenv(usernameEnv)
+
+		if res.Username == "" {
+			return nil, fmt.Errorf("environment variable %s referenced by \"username_env\" is not set", usernameEnv)
+		}
+	}
+
+	if passwordEnv != "" {
+		res.Password = os.Getenv(passwordEnv)
+
+		if res.Password == "" {
+			return nil, fmt.Errorf("environment variable %s referenced by \"password_env\" is not set", passwordEnv)
+		}
+	}
+
+	if credentialsFile != "" {
+		fileBytes, err := ioutil.ReadFile(resolvePath(credentialsFile, baseDir))
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading source credentials file: %v", err)
+		}
+
+		creds := &sourceCredentials{}
+
+		err = yaml.Unmarshal(fileBytes, creds)
+
+		if err != nil {
+			return nil, fmt.Errorf("error parsing source credentials file: %v", err)
+		}
+
+		res.Username = creds.Username
+		res.Password = creds.Password
+	}
+
+	caFile, _ := objutils.GetNestedString(genericSource, "ca_file")
+
+	if caFile != "" {
+		res.CAFile = resolvePath(caFile, baseDir)
+	}
+
+	insecure, err := objutils.GetNestedBool(genericSource, "insecure_skip_tls_verify")
+
+	if _, ok := err.(*objutils.NestedFieldNotFoundError); err != nil && !ok {
+		return nil, fmt.Errorf("source parameter \"insecure_skip_tls_verify\" must be a boolean")
+	}
+
+	res.InsecureSkipTLSVerify = insecure
+
+	return res, nil
+}
+
+// resolvePath returns the path relative to the base directory if it is not absolute
+func resolvePath(path, baseDir string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(baseDir, path)
+}
@@ -0,0 +1,373 @@
+//go:build sqlite
+// +build sqlite
+
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	// register the sqlite3 database driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteDriverName is the name of the SQLite storage driver
+const SQLiteDriverName = "SQLite"
+
+// sqliteSchema creates the same table that Helm's SQL driver creates in Postgres, so that
+// releases are stored in the same layout
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS releases_v1 (
+	key VARCHAR(67),
+	type VARCHAR(64) NOT NULL,
+	body TEXT NOT NULL,
+	name VARCHAR(64) NOT NULL,
+	namespace VARCHAR(64) NOT NULL,
+	version INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	owner TEXT NOT NULL,
+	createdAt INTEGER NOT NULL,
+	modifiedAt INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY(key, namespace)
+);
+CREATE INDEX IF NOT EXISTS releases_v1_name_namespace ON releases_v1 (name, namespace);
+CREATE INDEX IF NOT EXISTS releases_v1_status ON releases_v1 (status);
+`
+
+const (
+	sqliteReleaseOwner = "helm"
+	sqliteReleaseType  = "helm.sh/release.v1"
+)
+
+// sqliteLabels are the labels which releases can be queried by, which are stored as
+// columns of the releases table
+var sqliteLabels = map[string]bool{
+	"name":    true,
+	"owner":   true,
+	"status":  true,
+	"version": true,
+}
+
+// SQLite is a Helm storage driver which stores releases in a SQLite database. Helm's SQL
+// driver only supports Postgres.
+type SQLite struct {
+	db        *sql.DB
+	namespace string
+
+	Log func(string, ...interface{})
+}
+
+// NewSQLite opens the SQLite database at path, and creates the releases table if it does
+// not exist
+func NewSQLite(path string, logger func(string, ...interface{}), namespace string) (*SQLite, error) {
+	db, err := sql.Open("sqlite3", path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLite{
+		db:        db,
+		namespace: namespace,
+		Log:       logger,
+	}, nil
+}
+
+// newSQLiteDriver returns the SQLite driver used by the sql storage driver
+func newSQLiteDriver(path string, opts *StorageOpts) (driver.Driver, error) {
+	return NewSQLite(path, opts.Logger.Printf, opts.Namespace)
+}
+
+// Name returns the name of the driver
+func (s *SQLite) Name() string {
+	return SQLiteDriverName
+}
+
+// Get returns the release named by key
+func (s *SQLite) Get(key string) (*release.Release, error) {
+	var body string
+
+	err := s.db.QueryRow(
+		"SELECT body FROM releases_v1 WHERE key = ? AND namespace = ?",
+		key, s.namespace,
+	).Scan(&body)
+
+	if err == sql.ErrNoRows {
+		return nil, driver.ErrReleaseNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return decodeSQLiteRelease(body)
+}
+
+// List returns the releases for which filter returns true
+func (s *SQLite) List(filter func(*release.Release) bool) ([]*release.Release, error) {
+	query := "SELECT body FROM releases_v1 WHERE owner = ?"
+	args := []interface{}{sqliteReleaseOwner}
+
+	if s.namespace != "" {
+		query += " AND namespace = ?"
+		args = append(args, s.namespace)
+	}
+
+	releases, err := s.queryReleases(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*release.Release, 0)
+
+	for _, rel := range releases {
+		if filter(rel) {
+			res = append(res, rel)
+		}
+	}
+
+	return res, nil
+}
+
+// Query returns the releases which match every label
+func (s *SQLite) Query(labels map[string]string) ([]*release.Release, error) {
+	keys := make([]string, 0, len(labels))
+
+	for key := range labels {
+		if !sqliteLabels[key] {
+			return nil, fmt.Errorf("unknown label %s", key)
+		}
+
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	for _, key := range keys {
+		conditions = append(conditions, key+" = ?")
+		args = append(args, labels[key])
+	}
+
+	if s.namespace != "" {
+		conditions = append(conditions, "namespace = ?")
+		args = append(args, s.namespace)
+	}
+
+	query := "SELECT body FROM releases_v1"
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	releases, err := s.queryReleases(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(releases) == 0 {
+		return nil, driver.ErrReleaseNotFound
+	}
+
+	return releases, nil
+}
+
+// Create stores a new release, or returns ErrReleaseExists
+func (s *SQLite) Create(key string, rls *release.Release) error {
+	s.namespace = getReleaseNamespace(rls)
+
+	body, err := encodeSQLiteRelease(rls)
+
+	if err != nil {
+		return err
+	}
+
+	var exists int
+
+	err = s.db.QueryRow(
+		"SELECT COUNT(*) FROM releases_v1 WHERE key = ? AND namespace = ?",
+		key, s.namespace,
+	).Scan(&exists)
+
+	if err != nil {
+		return err
+	} else if exists > 0 {
+		return driver.ErrReleaseExists
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO releases_v1 (key, type, body, name, namespace, version, status, owner, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		key, sqliteReleaseType, body, rls.Name, s.namespace, rls.Version, getReleaseStatus(rls),
+		sqliteReleaseOwner, time.Now().Unix(),
+	)
+
+	if err != nil {
+		s.Log("failed to store release %s in SQLite database: %v", key, err)
+	}
+
+	return err
+}
+
+// Update updates a stored release
+func (s *SQLite) Update(key string, rls *release.Release) error {
+	s.namespace = getReleaseNamespace(rls)
+
+	body, err := encodeSQLiteRelease(rls)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		`UPDATE releases_v1 SET body = ?, name = ?, version = ?, status = ?, owner = ?, modifiedAt = ?
+		WHERE key = ? AND namespace = ?`,
+		body, rls.Name, rls.Version, getReleaseStatus(rls), sqliteReleaseOwner, time.Now().Unix(),
+		key, s.namespace,
+	)
+
+	if err != nil {
+		s.Log("failed to update release %s in SQLite database: %v", key, err)
+	}
+
+	return err
+}
+
+// Delete deletes a release, or returns ErrReleaseNotFound
+func (s *SQLite) Delete(key string) (*release.Release, error) {
+	rel, err := s.Get(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec("DELETE FROM releases_v1 WHERE key = ? AND namespace = ?", key, s.namespace)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rel, nil
+}
+
+func (s *SQLite) queryReleases(query string, args ...interface{}) ([]*release.Release, error) {
+	rows, err := s.db.Query(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	res := make([]*release.Release, 0)
+
+	for rows.Next() {
+		var body string
+
+		if err := rows.Scan(&body); err != nil {
+			return nil, err
+		}
+
+		rel, err := decodeSQLiteRelease(body)
+
+		if err != nil {
+			s.Log("failed to decode release: %v", err)
+			continue
+		}
+
+		res = append(res, rel)
+	}
+
+	return res, rows.Err()
+}
+
+func getReleaseNamespace(rls *release.Release) string {
+	if rls.Namespace == "" {
+		return "default"
+	}
+
+	return rls.Namespace
+}
+
+func getReleaseStatus(rls *release.Release) string {
+	if rls.Info == nil {
+		return ""
+	}
+
+	return rls.Info.Status.String()
+}
+
+// encodeSQLiteRelease encodes a release in the same format as Helm's storage drivers: as
+// base64-encoded, gzipped JSON
+func encodeSQLiteRelease(rls *release.Release) (string, error) {
+	releaseBytes, err := json.Marshal(rls)
+
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	writer, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := writer.Write(releaseBytes); err != nil {
+		return "", err
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decodeSQLiteRelease(body string) (*release.Release, error) {
+	gzipBytes, err := base64.StdEncoding.DecodeString(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(gzipBytes))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	releaseBytes, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rel := &release.Release{}
+
+	if err := json.Unmarshal(releaseBytes, rel); err != nil {
+		return nil, err
+	}
+
+	return rel, nil
+}
@@ -0,0 +1,16 @@
+//go:build !sqlite
+// +build !sqlite
+
+package helm
+
+import (
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// newSQLiteDriver returns an error, since the SQLite driver uses cgo and is only included
+// in builds with the sqlite tag
+func newSQLiteDriver(path string, opts *StorageOpts) (driver.Driver, error) {
+	return nil, fmt.Errorf("switchboard was built without SQLite support, rebuild it with cgo enabled and the sqlite build tag")
+}
@@ -0,0 +1,77 @@
+//go:build sqlite
+// +build sqlite
+
+package helm_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/drivers/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func getTestRelease(version int, status release.Status) *release.Release {
+	return &release.Release{
+		Name:      "web",
+		Namespace: "apps",
+		Version:   version,
+		Info:      &release.Info{Status: status},
+	}
+}
+
+func TestGetAgentSQLiteStorage(t *testing.T) {
+	opts := getTestAgentOpts("sql")
+	opts.SQLConnectionString = "sqlite://" + filepath.Join(t.TempDir(), "helm.db")
+
+	agent, err := helm.GetAgent(opts)
+
+	require.NoError(t, err)
+	assert.Equal(t, helm.SQLiteDriverName, agent.ActionConfig.Releases.Name())
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	d, err := helm.NewSQLite(filepath.Join(t.TempDir(), "helm.db"), t.Logf, "apps")
+
+	assert.NoError(t, err)
+	assert.NoError(t, d.Create("sh.helm.release.v1.web.v1", getTestRelease(1, release.StatusSuperseded)))
+	assert.NoError(t, d.Create("sh.helm.release.v1.web.v2", getTestRelease(2, release.StatusPendingUpgrade)))
+
+	err = d.Create("sh.helm.release.v1.web.v2", getTestRelease(2, release.StatusPendingUpgrade))
+
+	assert.Equal(t, driver.ErrReleaseExists, err)
+	assert.NoError(t, d.Update("sh.helm.release.v1.web.v2", getTestRelease(2, release.StatusDeployed)))
+
+	rel, err := d.Get("sh.helm.release.v1.web.v2")
+
+	assert.NoError(t, err)
+	assert.Equal(t, release.StatusDeployed, rel.Info.Status)
+
+	deployed, err := d.Query(map[string]string{"name": "web", "owner": "helm", "status": "deployed"})
+
+	assert.NoError(t, err)
+
+	if assert.Len(t, deployed, 1) {
+		assert.Equal(t, 2, deployed[0].Version)
+	}
+
+	all, err := d.List(func(rel *release.Release) bool { return true })
+
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	_, err = d.Delete("sh.helm.release.v1.web.v1")
+
+	assert.NoError(t, err)
+
+	_, err = d.Get("sh.helm.release.v1.web.v1")
+
+	assert.Equal(t, driver.ErrReleaseNotFound, err)
+
+	_, err = d.Query(map[string]string{"name": "api"})
+
+	assert.Equal(t, driver.ErrReleaseNotFound, err)
+}
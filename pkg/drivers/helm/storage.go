@@ -6,20 +6,34 @@ package helm
 // - configmap
 // - secret
 // - memory
+// - sql
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/rs/zerolog"
 	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
+// StorageOpts are the options used to initialize a Helm storage driver
+type StorageOpts struct {
+	Logger      *zerolog.Logger
+	V1Interface corev1.CoreV1Interface
+	Namespace   string
+
+	// SQLConnectionString is the DSN of the database used by the sql storage driver
+	SQLConnectionString string
+}
+
+// sqliteScheme is the prefix of connection strings which use the SQLite storage driver,
+// followed by the path to the database file
+const sqliteScheme = "sqlite://"
+
 // NewStorageDriver is a function type for returning a new storage driver
-type NewStorageDriver func(
-	l *zerolog.Logger,
-	v1Interface corev1.CoreV1Interface,
-	namespace string,
-) *storage.Storage
+type NewStorageDriver func(opts *StorageOpts) (*storage.Storage, error)
 
 // StorageMap is a map from storage configuration env variables to a function
 // that initializes that Helm storage driver.
@@ -27,36 +41,54 @@ var StorageMap map[string]NewStorageDriver = map[string]NewStorageDriver{
 	"secret":    newSecretStorageDriver,
 	"configmap": newConfigMapsStorageDriver,
 	"memory":    newMemoryStorageDriver,
+	"sql":       newSQLStorageDriver,
 }
 
 // NewSecretStorageDriver returns a storage using the Secret driver.
-func newSecretStorageDriver(
-	l *zerolog.Logger,
-	v1Interface corev1.CoreV1Interface,
-	namespace string,
-) *storage.Storage {
-	d := driver.NewSecrets(v1Interface.Secrets(namespace))
-	d.Log = l.Printf
-	return storage.Init(d)
+func newSecretStorageDriver(opts *StorageOpts) (*storage.Storage, error) {
+	d := driver.NewSecrets(opts.V1Interface.Secrets(opts.Namespace))
+	d.Log = opts.Logger.Printf
+	return storage.Init(d), nil
 }
 
 // NewConfigMapsStorageDriver returns a storage using the ConfigMap driver.
-func newConfigMapsStorageDriver(
-	l *zerolog.Logger,
-	v1Interface corev1.CoreV1Interface,
-	namespace string,
-) *storage.Storage {
-	d := driver.NewConfigMaps(v1Interface.ConfigMaps(namespace))
-	d.Log = l.Printf
-	return storage.Init(d)
+func newConfigMapsStorageDriver(opts *StorageOpts) (*storage.Storage, error) {
+	d := driver.NewConfigMaps(opts.V1Interface.ConfigMaps(opts.Namespace))
+	d.Log = opts.Logger.Printf
+	return storage.Init(d), nil
 }
 
 // NewMemoryStorageDriver returns a storage using the In-Memory driver.
-func newMemoryStorageDriver(
-	_ *zerolog.Logger,
-	_ corev1.CoreV1Interface,
-	_ string,
-) *storage.Storage {
+func newMemoryStorageDriver(opts *StorageOpts) (*storage.Storage, error) {
 	d := driver.NewMemory()
-	return storage.Init(d)
+	d.SetNamespace(opts.Namespace)
+	return storage.Init(d), nil
+}
+
+// newSQLStorageDriver returns a storage using a SQL driver. Connection strings starting
+// with sqlite:// use the SQLite driver, and any other connection string uses Helm's SQL
+// driver, which only supports Postgres. Both drivers connect to the database and create
+// the releases table when they are initialized.
+func newSQLStorageDriver(opts *StorageOpts) (*storage.Storage, error) {
+	if opts.SQLConnectionString == "" {
+		return nil, fmt.Errorf("a connection string must be set when using the sql storage driver")
+	}
+
+	if strings.HasPrefix(opts.SQLConnectionString, sqliteScheme) {
+		d, err := newSQLiteDriver(strings.TrimPrefix(opts.SQLConnectionString, sqliteScheme), opts)
+
+		if err != nil {
+			return nil, fmt.Errorf("error initializing sqlite storage driver: %v", err)
+		}
+
+		return storage.Init(d), nil
+	}
+
+	d, err := driver.NewSQL(opts.SQLConnectionString, opts.Logger.Printf, opts.Namespace)
+
+	if err != nil {
+		return nil, fmt.Errorf("error initializing sql storage driver: %v", err)
+	}
+
+	return storage.Init(d), nil
 }
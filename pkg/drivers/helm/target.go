@@ -1,6 +1,11 @@
 package helm
 
 import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
 	"github.com/porter-dev/switchboard/pkg/drivers/kubernetes"
 	"github.com/porter-dev/switchboard/utils/objutils"
 	"github.com/rs/zerolog"
@@ -13,6 +18,32 @@ type Target struct {
 
 	// Helm-specific fields
 	Name string
+
+	// Storage is the Helm storage driver which stores the release, which is one of
+	// secret, configmap, memory or sql. Defaults to secret.
+	Storage string
+
+	// SQLConnectionString is the DSN of the Postgres database used by the sql storage
+	// driver
+	SQLConnectionString string
+
+	// ReuseValues merges the values of the live release into the config on upgrade
+	ReuseValues bool
+
+	// ResetValues discards the values of the live release on upgrade, and only uses the
+	// chart's default values and the config
+	ResetValues bool
+
+	// Atomic rolls the release back if an install or upgrade fails. It implies Wait.
+	Atomic bool
+
+	// Wait waits for the release's resources to become ready before an install or
+	// upgrade is marked as successful
+	Wait bool
+
+	// MaxHistory is the maximum number of revisions kept for the release. If it is 0,
+	// the number of revisions is not limited.
+	MaxHistory int
 }
 
 func GetTarget(genericTarget map[string]interface{}, logger *zerolog.Logger) (*Target, error) {
@@ -26,12 +57,19 @@ func GetTarget(genericTarget map[string]interface{}, logger *zerolog.Logger) (*T
 
 	res.Target = kubeTarget
 
+	err = res.getStorage(genericTarget)
+
+	if err != nil {
+		return nil, err
+	}
+
 	// get the Helm agent from the kube Agent
 	agent, err := GetAgent(&GetAgentOpts{
-		Namespace: kubeTarget.Namespace,
-		Storage:   "secret",
-		Agent:     kubeTarget.Agent,
-		Logger:    logger,
+		Namespace:           kubeTarget.Namespace,
+		Storage:             res.Storage,
+		SQLConnectionString: res.SQLConnectionString,
+		Agent:               kubeTarget.Agent,
+		Logger:              logger,
 	})
 
 	if err != nil {
@@ -46,5 +84,78 @@ func GetTarget(genericTarget map[string]interface{}, logger *zerolog.Logger) (*T
 
 	res.agent = agent
 
+	for field, dst := range map[string]*bool{
+		"reuse_values": &res.ReuseValues,
+		"reset_values": &res.ResetValues,
+		"atomic":       &res.Atomic,
+		"wait":         &res.Wait,
+	} {
+		*dst, err = objutils.GetNestedBool(genericTarget, field)
+
+		if _, ok := err.(*objutils.NestedFieldNotFoundError); err != nil && !ok {
+			return nil, fmt.Errorf("target parameter \"%s\" must be a boolean", field)
+		}
+	}
+
+	if res.ReuseValues && res.ResetValues {
+		return nil, fmt.Errorf("target parameters \"reuse_values\" and \"reset_values\" cannot both be set")
+	}
+
+	res.MaxHistory, err = objutils.GetNestedInt(genericTarget, "max_history")
+
+	if _, ok := err.(*objutils.NestedFieldNotFoundError); err != nil && !ok {
+		return nil, fmt.Errorf("target parameter \"max_history\" must be an integer")
+	} else if res.MaxHistory < 0 {
+		return nil, fmt.Errorf("target parameter \"max_history\" cannot be negative")
+	}
+
 	return res, nil
 }
+
+// sqlConnectionStringEnv is the environment variable which Helm reads the connection
+// string of the sql storage driver from. It is used if the target does not set
+// "sql_connection_string".
+const sqlConnectionStringEnv = "HELM_DRIVER_SQL_CONNECTION_STRING"
+
+// getStorage reads the storage driver and its options from the target
+func (t *Target) getStorage(genericTarget map[string]interface{}) error {
+	storage, err := objutils.GetNestedString(genericTarget, "storage")
+
+	if _, ok := err.(*objutils.NestedFieldNotFoundError); err != nil && !ok {
+		return fmt.Errorf("target parameter \"storage\" must be a string")
+	} else if storage == "" {
+		storage = "secret"
+	}
+
+	if _, ok := StorageMap[storage]; !ok {
+		supported := make([]string, 0, len(StorageMap))
+
+		for name := range StorageMap {
+			supported = append(supported, name)
+		}
+
+		sort.Strings(supported)
+
+		return fmt.Errorf("target parameter \"storage\" must be one of %s", strings.Join(supported, ", "))
+	}
+
+	t.Storage = storage
+
+	connectionString, _ := objutils.GetNestedString(genericTarget, "sql_connection_string")
+
+	if connectionString != "" && storage != "sql" {
+		return fmt.Errorf("target parameter \"sql_connection_string\" can only be set when using the sql storage")
+	}
+
+	if storage == "sql" && connectionString == "" {
+		connectionString = os.Getenv(sqlConnectionStringEnv)
+
+		if connectionString == "" {
+			return fmt.Errorf("the sql storage requires \"sql_connection_string\" or the %s environment variable to be set", sqlConnectionStringEnv)
+		}
+	}
+
+	t.SQLConnectionString = connectionString
+
+	return nil
+}
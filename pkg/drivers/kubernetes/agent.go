@@ -8,8 +8,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/porter-dev/switchboard/pkg/drivers"
 	"github.com/porter-dev/switchboard/utils/objutils"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
@@ -28,58 +30,227 @@ type ApplyOpts struct {
 	Target *Target
 }
 
-func (a *Agent) Apply(opts *ApplyOpts) (map[string]interface{}, error) {
+// Apply writes the object to the cluster with server-side apply, falling back to a
+// client-side three-way merge if server-side apply is not supported.
+func (a *Agent) Apply(ctx context.Context, opts *ApplyOpts) (map[string]interface{}, error) {
 	// override the base config with the specified resource's config
 	obj := objutils.CoalesceValues(opts.Base, opts.Config)
-	gvr, err := a.getGroupVersionResource(obj)
+	dynResource, name, err := a.getResourceClient(obj, opts.Target)
 
 	if err != nil {
-		return nil, fmt.Errorf("could not get API group, version, or resource: %v", err)
+		return nil, err
 	}
 
-	dynResource := a.DynamicClientset.Resource(*gvr).Namespace(opts.Target.Namespace)
+	unstructObj, err := applyObject(ctx, dynResource, name, obj, opts.Target, false)
 
-	// attempt to get the resource
-	name, err := getObjectName(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return unstructObj.Object, nil
+}
+
+// Delete deletes the object from the cluster using the target's propagation policy.
+// If the object does not exist, no error is returned.
+func (a *Agent) Delete(ctx context.Context, opts *ApplyOpts) error {
+	obj := objutils.CoalesceValues(opts.Base, opts.Config)
+	dynResource, name, err := a.getResourceClient(obj, opts.Target)
+
+	if err != nil {
+		return err
+	}
+
+	err = dynResource.Delete(ctx, name, metav1.DeleteOptions{
+		PropagationPolicy: &opts.Target.PropagationPolicy,
+	})
+
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting the resource: %v", err)
+	}
+
+	return nil
+}
+
+// Get returns the live object from the cluster, or nil if it does not exist
+func (a *Agent) Get(ctx context.Context, opts *ApplyOpts) (map[string]interface{}, error) {
+	obj := objutils.CoalesceValues(opts.Base, opts.Config)
+	dynResource, name, err := a.getResourceClient(obj, opts.Target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := dynResource.Get(ctx, name, metav1.GetOptions{})
+
+	if err != nil && errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting the resource: %v", err)
+	}
+
+	return live.Object, nil
+}
+
+// Restore writes a previous revision of the object back to the cluster, and returns
+// the restored object. If the previous revision is nil, the object is deleted.
+func (a *Agent) Restore(ctx context.Context, opts *ApplyOpts, previous map[string]interface{}) (map[string]interface{}, error) {
+	if previous == nil {
+		return nil, a.Delete(ctx, opts)
+	}
+
+	obj := stripServerFields(previous)
+	unstructured.RemoveNestedField(obj, "status")
+
+	dynResource, name, err := a.getResourceClient(obj, opts.Target)
 
 	if err != nil {
-		return nil, fmt.Errorf("could not get object name: %v", err)
+		return nil, err
 	}
 
-	_, err = dynResource.Get(context.TODO(), name, metav1.GetOptions{})
-	var res map[string]interface{}
+	live, err := dynResource.Get(ctx, name, metav1.GetOptions{})
 
-	// check if the error is a resource "NotFound" error
 	if err != nil && errors.IsNotFound(err) {
-		// create the resource
-		unstructObj, err := dynResource.Create(context.TODO(), &unstructured.Unstructured{
+		unstructObj, err := dynResource.Create(ctx, &unstructured.Unstructured{
 			Object: obj,
-		}, metav1.CreateOptions{})
+		}, metav1.CreateOptions{
+			FieldManager: fieldManager,
+		})
 
 		if err != nil {
 			return nil, err
 		}
 
-		res = unstructObj.Object
+		return unstructObj.Object, nil
 	} else if err != nil {
 		return nil, fmt.Errorf("error getting the resource: %v", err)
+	}
+
+	// the update must be made against the current revision of the object
+	restored := &unstructured.Unstructured{
+		Object: obj,
+	}
+
+	restored.SetResourceVersion(live.GetResourceVersion())
+
+	unstructObj, err := dynResource.Update(ctx, restored, metav1.UpdateOptions{
+		FieldManager: fieldManager,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return unstructObj.Object, nil
+}
+
+// Plan performs a server-side dry run of the apply operation, and returns a diff between
+// the live object and the object that would be written, along with the dry run result.
+func (a *Agent) Plan(ctx context.Context, opts *ApplyOpts) (*drivers.Plan, map[string]interface{}, error) {
+	obj := objutils.CoalesceValues(opts.Base, opts.Config)
+	dynResource, name, err := a.getResourceClient(obj, opts.Target)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	live, err := dynResource.Get(ctx, name, metav1.GetOptions{})
+	exists := err == nil
+
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, nil, fmt.Errorf("error getting the resource: %v", err)
+	}
+
+	unstructObj, err := applyObject(ctx, dynResource, name, obj, opts.Target, true)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan := &drivers.Plan{
+		Action: drivers.PlanActionUpdate,
+	}
+
+	var liveObj map[string]interface{}
+
+	if exists {
+		liveObj = stripForDiff(live.Object)
 	} else {
-		// update the resource
-		unstructObj, err := dynResource.Update(context.TODO(), &unstructured.Unstructured{
-			Object: obj,
-		}, metav1.UpdateOptions{})
+		plan.Action = drivers.PlanActionCreate
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	plan.Diff, err = objutils.DiffYAML(liveObj, stripForDiff(unstructObj.Object))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if plan.Diff == "" {
+		plan.Action = drivers.PlanActionNoop
+	}
+
+	return plan, unstructObj.Object, nil
+}
+
+// stripForDiff returns a copy of the object without server-managed fields and the
+// last applied annotation, which would otherwise duplicate the diff
+func stripForDiff(obj map[string]interface{}) map[string]interface{} {
+	res := stripServerFields(obj)
+	unstructured.RemoveNestedField(res, "metadata", "annotations", lastAppliedAnnotation)
+
+	if annotations, _, _ := unstructured.NestedMap(res, "metadata", "annotations"); len(annotations) == 0 {
+		unstructured.RemoveNestedField(res, "metadata", "annotations")
+	}
+
+	return res
+}
 
-		res = unstructObj.Object
+// stripServerFields returns a copy of the object without the metadata fields that
+// are managed by the API server, so that they do not show up in diffs.
+func stripServerFields(obj map[string]interface{}) map[string]interface{} {
+	res := (&unstructured.Unstructured{Object: obj}).DeepCopy()
+
+	for _, field := range []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp", "selfLink"} {
+		unstructured.RemoveNestedField(res.Object, "metadata", field)
 	}
 
-	return res, nil
+	return res.Object
 }
 
-func (a *Agent) getGroupVersionResource(obj map[string]interface{}) (*schema.GroupVersionResource, error) {
+// getResourceClient returns a client for the object's resource along with the name of
+// the object. Namespaced objects use the namespace in their metadata, or the target
+// namespace if it is not set.
+func (a *Agent) getResourceClient(obj map[string]interface{}, target *Target) (dynamic.ResourceInterface, string, error) {
+	mapping, err := a.getRESTMapping(obj)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("could not get API group, version, or resource: %v", err)
+	}
+
+	name, err := getObjectName(obj)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("could not get object name: %v", err)
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return a.DynamicClientset.Resource(mapping.Resource), name, nil
+	}
+
+	return a.DynamicClientset.Resource(mapping.Resource).Namespace(getObjectNamespace(obj, target)), name, nil
+}
+
+// IsNamespaced returns true if the kind of the object is namespace-scoped
+func (a *Agent) IsNamespaced(obj map[string]interface{}) (bool, error) {
+	mapping, err := a.getRESTMapping(obj)
+
+	if err != nil {
+		return false, err
+	}
+
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+func (a *Agent) getRESTMapping(obj map[string]interface{}) (*meta.RESTMapping, error) {
 	// get the apiVersion and kind from the object
 	apiVersion, apiVersionExists := obj["apiVersion"]
 
@@ -124,7 +295,7 @@ func (a *Agent) getGroupVersionResource(obj map[string]interface{}) (*schema.Gro
 		return nil, fmt.Errorf("error creating a REST mapping: %v", err)
 	}
 
-	return &mapping.Resource, nil
+	return mapping, nil
 }
 
 func getObjectName(obj map[string]interface{}) (string, error) {
@@ -154,3 +325,15 @@ func getObjectName(obj map[string]interface{}) (string, error) {
 
 	return name, nil
 }
+
+// getObjectNamespace returns the namespace in the object's metadata, or the target
+// namespace if it is not set
+func getObjectNamespace(obj map[string]interface{}, target *Target) string {
+	namespace, _ := objutils.GetNestedString(obj, "metadata", "namespace")
+
+	if namespace == "" {
+		return target.Namespace
+	}
+
+	return namespace
+}
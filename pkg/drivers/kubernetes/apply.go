@@ -0,0 +1,174 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fieldManager is the name of the field manager that owns the fields written by
+// switchboard
+const fieldManager = "switchboard"
+
+// lastAppliedAnnotation stores the configuration that was last applied to an object,
+// which is used to compute three-way merge patches when server-side apply is not
+// supported by the API server
+const lastAppliedAnnotation = "switchboard.getporter.dev/last-applied-configuration"
+
+// applyObject writes the object to the cluster using server-side apply. If the API
+// server does not support server-side apply, a client-side three-way merge is
+// performed instead.
+func applyObject(
+	ctx context.Context,
+	dynResource dynamic.ResourceInterface,
+	name string,
+	obj map[string]interface{},
+	target *Target,
+	dryRun bool,
+) (*unstructured.Unstructured, error) {
+	res, err := serverSideApply(ctx, dynResource, name, obj, target, dryRun)
+
+	if err != nil && (errors.IsUnsupportedMediaType(err) || errors.IsMethodNotSupported(err)) {
+		return threeWayMerge(ctx, dynResource, name, obj, dryRun)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// serverSideApply sends the object as an apply patch, so that the API server merges
+// the object with the live object and only takes ownership of the fields that are set
+func serverSideApply(
+	ctx context.Context,
+	dynResource dynamic.ResourceInterface,
+	name string,
+	obj map[string]interface{},
+	target *Target,
+	dryRun bool,
+) (*unstructured.Unstructured, error) {
+	data, err := json.Marshal(obj)
+
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the object: %v", err)
+	}
+
+	force := target.ForceConflicts
+
+	patchOpts := metav1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+	}
+
+	if dryRun {
+		patchOpts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	return dynResource.Patch(ctx, name, types.ApplyPatchType, data, patchOpts)
+}
+
+// threeWayMerge computes a patch between the last applied configuration, the object,
+// and the live object, and patches the live object. The object is stored in the last
+// applied annotation, so that fields which are removed from the object are removed
+// from the live object on the next apply.
+func threeWayMerge(
+	ctx context.Context,
+	dynResource dynamic.ResourceInterface,
+	name string,
+	obj map[string]interface{},
+	dryRun bool,
+) (*unstructured.Unstructured, error) {
+	lastApplied, err := json.Marshal(obj)
+
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the object: %v", err)
+	}
+
+	modified := (&unstructured.Unstructured{Object: obj}).DeepCopy()
+	annotations := modified.GetAnnotations()
+
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[lastAppliedAnnotation] = string(lastApplied)
+	modified.SetAnnotations(annotations)
+
+	var dryRunOpt []string
+
+	if dryRun {
+		dryRunOpt = []string{metav1.DryRunAll}
+	}
+
+	live, err := dynResource.Get(ctx, name, metav1.GetOptions{})
+
+	if err != nil && errors.IsNotFound(err) {
+		return dynResource.Create(ctx, modified, metav1.CreateOptions{
+			FieldManager: fieldManager,
+			DryRun:       dryRunOpt,
+		})
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting the resource: %v", err)
+	}
+
+	original := []byte(live.GetAnnotations()[lastAppliedAnnotation])
+
+	modifiedBytes, err := json.Marshal(modified.Object)
+
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the object: %v", err)
+	}
+
+	current, err := json.Marshal(live.Object)
+
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the live object: %v", err)
+	}
+
+	patchType, patch, err := createThreeWayPatch(original, modifiedBytes, current, modified.GroupVersionKind())
+
+	if err != nil {
+		return nil, fmt.Errorf("error computing patch: %v", err)
+	}
+
+	return dynResource.Patch(ctx, name, patchType, patch, metav1.PatchOptions{
+		FieldManager: fieldManager,
+		DryRun:       dryRunOpt,
+	})
+}
+
+// createThreeWayPatch returns a strategic merge patch for built-in kinds, and a JSON
+// merge patch for kinds which are not known to the client, such as custom resources.
+func createThreeWayPatch(original, modified, current []byte, gvk schema.GroupVersionKind) (types.PatchType, []byte, error) {
+	versionedObj, err := scheme.Scheme.New(gvk)
+
+	if err != nil && runtime.IsNotRegisteredError(err) {
+		patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+
+		return types.MergePatchType, patch, err
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	lookupPatchMeta, err := strategicpatch.NewPatchMetaFromStruct(versionedObj)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, current, lookupPatchMeta, true)
+
+	return types.StrategicMergePatchType, patch, err
+}
@@ -1,23 +1,28 @@
 package kubernetes
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/porter-dev/switchboard/pkg/drivers"
 	"github.com/porter-dev/switchboard/pkg/models"
-
-	"sigs.k8s.io/yaml"
 )
 
 type Driver struct {
 	source      *Source
 	target      *Target
-	base        map[string]interface{}
+	bases       []map[string]interface{}
 	output      map[string]interface{}
+	outputMask  map[string]interface{}
 	lookupTable *map[string]drivers.Driver
+
+	// previous contains the live objects recorded by Checkpoint, which are nil if
+	// the object did not exist
+	previous       []map[string]interface{}
+	checkpointOpts []*ApplyOpts
 }
 
 func NewKubernetesDriver(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
@@ -55,15 +60,16 @@ func (d *Driver) GetAgent() *Agent {
 }
 
 func (d *Driver) initSource(source *Source, opts *drivers.SharedDriverOpts) error {
-	// read the file and set the base variable
+	// if there is no source, the object is read entirely from the config
+	d.bases = []map[string]interface{}{{}}
+
+	// read the manifests and set the base objects
 	switch source.Kind {
 	case SourceKindLocal:
 		path := source.SourceLocal.Path
-		base := make(map[string]interface{})
 
 		// if the path is empty, just set the base to the empty map
 		if path == "" {
-			d.base = base
 			return nil
 		}
 
@@ -72,38 +78,71 @@ func (d *Driver) initSource(source *Source, opts *drivers.SharedDriverOpts) erro
 			path = filepath.Join(opts.BaseDir, path)
 		}
 
-		// check if the file exists
-		if info, err := os.Stat(path); os.IsNotExist(err) || info.IsDir() {
-			return fmt.Errorf("source file specified by \"path\" does not exist or is a directory")
+		// check if the file or directory exists
+		info, err := os.Stat(path)
+
+		if os.IsNotExist(err) {
+			return fmt.Errorf("source file or directory specified by \"path\" does not exist")
+		} else if err != nil {
+			return fmt.Errorf("error reading source specified by \"path\": %v", err)
 		}
 
-		fileBytes, err := ioutil.ReadFile(path)
+		bases, err := readManifests(path, source.SourceLocal.Glob, info.IsDir())
 
 		if err != nil {
-			return fmt.Errorf("error reading source file specified by \"path\": %v", err)
+			return err
+		}
+
+		if len(bases) == 0 {
+			return fmt.Errorf("no objects found in source specified by \"path\"")
+		}
+
+		d.bases = bases
+	case SourceKindKustomize:
+		path := source.SourceKustomize.Path
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(opts.BaseDir, path)
+		}
+
+		if info, err := os.Stat(path); os.IsNotExist(err) || !info.IsDir() {
+			return fmt.Errorf("source directory specified by \"path\" does not exist or is not a directory")
 		}
 
-		// parse the file bytes to yaml
-		err = yaml.Unmarshal(fileBytes, &base)
+		bases, err := buildKustomization(path)
 
 		if err != nil {
-			return fmt.Errorf("error parsing source file specified by \"path\" as yaml: %v", err)
+			return err
+		}
+
+		if len(bases) == 0 {
+			return fmt.Errorf("no objects found in kustomization specified by \"path\"")
 		}
 
-		d.base = base
+		d.bases = bases
 	}
 
 	return nil
 }
 
-func (d *Driver) ShouldApply(resource *models.Resource) bool {
-	return true
+// ShouldApply returns false if planning the resource results in no changes. In
+// that case, the output is set from the plan.
+func (d *Driver) ShouldApply(ctx context.Context, resource *models.Resource) bool {
+	plan, err := d.Plan(ctx, resource)
+
+	if err != nil {
+		return true
+	}
+
+	return plan.Action != drivers.PlanActionNoop
 }
 
-func (d *Driver) Apply(resource *models.Resource) (*models.Resource, error) {
+// Apply applies every object in the source, in the order that they were read
+func (d *Driver) Apply(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
 	// get the config based on data population
-	config, err := drivers.ConstructConfig(&drivers.ConstructConfigOpts{
+	config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
 		RawConf:      resource.Config,
+		RawConfMask:  resource.ConfigMask,
 		LookupTable:  *d.lookupTable,
 		Dependencies: resource.Dependencies,
 	})
@@ -112,22 +151,313 @@ func (d *Driver) Apply(resource *models.Resource) (*models.Resource, error) {
 		return nil, err
 	}
 
-	res, err := d.target.Agent.Apply(&ApplyOpts{
-		Config: config,
-		Base:   d.base,
-		Target: d.target,
+	allApplyOpts, err := d.getApplyOpts(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]map[string]interface{}, 0)
+
+	for _, applyOpts := range allApplyOpts {
+		res, err := d.target.Agent.Apply(ctx, applyOpts)
+
+		if err != nil {
+			return nil, d.getObjectError(applyOpts, err)
+		}
+
+		objects = append(objects, res)
+	}
+
+	d.setOutput(objects)
+
+	return resource, nil
+}
+
+// Plan plans every object in the source. The resource is created if every object is
+// created, and updated if any object is changed.
+func (d *Driver) Plan(ctx context.Context, resource *models.Resource) (*drivers.Plan, error) {
+	config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
+		RawConf:      resource.Config,
+		RawConfMask:  resource.ConfigMask,
+		LookupTable:  *d.lookupTable,
+		Dependencies: resource.Dependencies,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	d.output = res
+	allApplyOpts, err := d.getApplyOpts(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := &drivers.Plan{
+		Action: drivers.PlanActionNoop,
+	}
+
+	var diff strings.Builder
+	objects := make([]map[string]interface{}, 0)
+
+	for _, applyOpts := range allApplyOpts {
+		plan, obj, err := d.target.Agent.Plan(ctx, applyOpts)
+
+		if err != nil {
+			return nil, d.getObjectError(applyOpts, err)
+		}
+
+		objects = append(objects, obj)
+
+		if plan.Action == drivers.PlanActionNoop {
+			continue
+		}
+
+		if res.Action == drivers.PlanActionNoop {
+			res.Action = plan.Action
+		} else if res.Action != plan.Action {
+			res.Action = drivers.PlanActionUpdate
+		}
+
+		if len(allApplyOpts) > 1 {
+			diff.WriteString(fmt.Sprintf("# %s\n", d.getBaseKey(applyOpts.Base)))
+		}
+
+		diff.WriteString(plan.Diff)
+	}
+
+	res.Diff = diff.String()
+
+	d.setOutput(objects)
+
+	return res, nil
+}
+
+// Delete deletes every object in the source, in the reverse order that they were read.
+// If the resource is pruned, the objects in its saved output are deleted instead, since
+// its config is no longer declared.
+func (d *Driver) Delete(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	allApplyOpts, err := d.getDeleteOpts(ctx, resource)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(allApplyOpts) - 1; i >= 0; i-- {
+		err = d.target.Agent.Delete(ctx, allApplyOpts[i])
+
+		if err != nil {
+			return nil, d.getObjectError(allApplyOpts[i], err)
+		}
+	}
+
+	d.output = nil
+	d.outputMask = nil
 
 	return resource, nil
 }
 
-// Output returns the created Kubernetes configuration, including status section.
-func (d *Driver) Output() (map[string]interface{}, error) {
+// getDeleteOpts returns the options for deleting each object of the resource
+func (d *Driver) getDeleteOpts(ctx context.Context, resource *models.Resource) ([]*ApplyOpts, error) {
+	if objects := GetOutputObjects(resource.SavedOutput); len(objects) > 0 {
+		res := make([]*ApplyOpts, 0)
+
+		for _, obj := range objects {
+			res = append(res, &ApplyOpts{
+				Base:   obj,
+				Target: d.target,
+			})
+		}
+
+		return res, nil
+	}
+
+	config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
+		RawConf:      resource.Config,
+		RawConfMask:  resource.ConfigMask,
+		LookupTable:  *d.lookupTable,
+		Dependencies: resource.Dependencies,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return d.getApplyOpts(config)
+}
+
+// Checkpoint records the live objects, so that they can be restored by Rollback
+func (d *Driver) Checkpoint(ctx context.Context, resource *models.Resource) error {
+	config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
+		RawConf:      resource.Config,
+		RawConfMask:  resource.ConfigMask,
+		LookupTable:  *d.lookupTable,
+		Dependencies: resource.Dependencies,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	allApplyOpts, err := d.getApplyOpts(config)
+
+	if err != nil {
+		return err
+	}
+
+	previous := make([]map[string]interface{}, 0)
+
+	for _, applyOpts := range allApplyOpts {
+		obj, err := d.target.Agent.Get(ctx, applyOpts)
+
+		if err != nil {
+			return d.getObjectError(applyOpts, err)
+		}
+
+		previous = append(previous, obj)
+	}
+
+	d.previous = previous
+	d.checkpointOpts = allApplyOpts
+
+	return nil
+}
+
+// Rollback restores the objects recorded by Checkpoint in the reverse order that they
+// were applied, and deletes the objects which did not exist before they were applied.
+func (d *Driver) Rollback(ctx context.Context, current, previous *models.Resource) error {
+	if d.checkpointOpts == nil {
+		return fmt.Errorf("no checkpoint was recorded for resource %s", current.Name)
+	}
+
+	objects := make([]map[string]interface{}, 0)
+
+	for i := len(d.checkpointOpts) - 1; i >= 0; i-- {
+		res, err := d.target.Agent.Restore(ctx, d.checkpointOpts[i], d.previous[i])
+
+		if err != nil {
+			return d.getObjectError(d.checkpointOpts[i], err)
+		}
+
+		if res != nil {
+			objects = append([]map[string]interface{}{res}, objects...)
+		}
+	}
+
+	d.setOutput(objects)
+
+	return nil
+}
+
+// Wait waits for the objects in the source to become ready, and sets the output to the
+// final observed objects
+func (d *Driver) Wait(ctx context.Context, resource *models.Resource) error {
+	config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
+		RawConf:      resource.Config,
+		RawConfMask:  resource.ConfigMask,
+		LookupTable:  *d.lookupTable,
+		Dependencies: resource.Dependencies,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	allApplyOpts, err := d.getApplyOpts(config)
+
+	if err != nil {
+		return err
+	}
+
+	objects, err := d.target.Agent.Wait(ctx, allApplyOpts, resource.Wait)
+
+	if objects != nil {
+		d.setOutput(objects)
+	}
+
+	return err
+}
+
+// getApplyOpts returns the options for applying each object in the source. If the
+// source contains a single object, the config overrides that object. Otherwise, each
+// top-level key in the config must be the key of an object in the source, in the form
+// kind/namespace/name or kind/name, and its value overrides that object.
+func (d *Driver) getApplyOpts(config map[string]interface{}) ([]*ApplyOpts, error) {
+	if len(d.bases) == 1 {
+		return []*ApplyOpts{{
+			Config: config,
+			Base:   d.bases[0],
+			Target: d.target,
+		}}, nil
+	}
+
+	res := make([]*ApplyOpts, 0)
+	matched := make(map[string]bool)
+
+	for _, base := range d.bases {
+		applyOpts := &ApplyOpts{
+			Base:   base,
+			Target: d.target,
+		}
+
+		for _, key := range []string{d.getBaseKey(base), getObjectKey(base, "")} {
+			override, ok := config[key]
+
+			if !ok {
+				continue
+			}
+
+			overrideMap, ok := override.(map[string]interface{})
+
+			if !ok {
+				return nil, fmt.Errorf("config for object %s is not an object", key)
+			}
+
+			applyOpts.Config = overrideMap
+			matched[key] = true
+		}
+
+		res = append(res, applyOpts)
+	}
+
+	for key := range config {
+		if !matched[key] {
+			return nil, fmt.Errorf("config key %s does not match any object in the source", key)
+		}
+	}
+
+	return res, nil
+}
+
+// getBaseKey returns the key of an object in the source, using the target namespace if
+// the object does not set a namespace
+func (d *Driver) getBaseKey(base map[string]interface{}) string {
+	return getObjectKey(base, getObjectNamespace(base, d.target))
+}
+
+func (d *Driver) getObjectError(applyOpts *ApplyOpts, err error) error {
+	if len(d.bases) == 1 {
+		return err
+	}
+
+	return fmt.Errorf("%s: %w", d.getBaseKey(applyOpts.Base), err)
+}
+
+// setOutput sets the output from objects returned by the API server. If the source
+// contains a single object, the fields of the object are also set at the top level of
+// the output.
+func (d *Driver) setOutput(objects []map[string]interface{}) {
+	d.output = GetObjectsOutput(objects, len(d.bases) == 1)
+	d.outputMask = GetObjectsOutputMask(objects, len(d.bases) == 1)
+}
+
+// Output returns the created Kubernetes objects, including status sections
+func (d *Driver) Output(ctx context.Context) (map[string]interface{}, error) {
 	return d.output, nil
 }
+
+// SensitiveOutput marks the data of Secrets in the output as sensitive
+func (d *Driver) SensitiveOutput(ctx context.Context) (map[string]interface{}, error) {
+	return d.outputMask, nil
+}
@@ -0,0 +1,271 @@
+package kubernetes
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/porter-dev/switchboard/utils/objutils"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/yaml"
+)
+
+// readManifests reads every object from a manifest file, or from the files in a
+// directory and its subdirectories. If glob is set, only files whose name matches
+// the glob are read from a directory. Otherwise, files with a .yaml, .yml or .json
+// extension are read. Objects are returned in the order that they appear, with files
+// read in lexical order.
+func readManifests(path, glob string, isDir bool) ([]map[string]interface{}, error) {
+	if !isDir {
+		return readManifestFile(path)
+	}
+
+	res := make([]map[string]interface{}, 0)
+
+	err := filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		isManifest, err := matchesManifest(entry.Name(), glob)
+
+		if err != nil {
+			return err
+		} else if !isManifest {
+			return nil
+		}
+
+		objects, err := readManifestFile(filePath)
+
+		if err != nil {
+			return err
+		}
+
+		res = append(res, objects...)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func matchesManifest(name, glob string) (bool, error) {
+	if glob != "" {
+		isMatch, err := filepath.Match(glob, name)
+
+		if err != nil {
+			return false, fmt.Errorf("invalid glob %s: %v", glob, err)
+		}
+
+		return isMatch, nil
+	}
+
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func readManifestFile(path string) ([]map[string]interface{}, error) {
+	fileBytes, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest %s: %v", path, err)
+	}
+
+	objects, err := ParseManifests(fileBytes)
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s as yaml: %v", path, err)
+	}
+
+	return objects, nil
+}
+
+// buildKustomization builds the kustomization in a directory, and returns the
+// resulting objects
+func buildKustomization(path string) ([]map[string]interface{}, error) {
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+
+	resMap, err := kustomizer.Run(filesys.MakeFsOnDisk(), path)
+
+	if err != nil {
+		return nil, fmt.Errorf("error building kustomization %s: %v", path, err)
+	}
+
+	data, err := resMap.AsYaml()
+
+	if err != nil {
+		return nil, fmt.Errorf("error encoding kustomization %s: %v", path, err)
+	}
+
+	return ParseManifests(data)
+}
+
+// ParseManifests parses every document in a multi-document yaml file. Empty documents
+// are skipped, and the items of a List are returned as separate objects.
+func ParseManifests(data []byte) ([]map[string]interface{}, error) {
+	res := make([]map[string]interface{}, 0)
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+
+	for {
+		doc, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		obj := make(map[string]interface{})
+
+		err = yaml.Unmarshal(doc, &obj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(obj) == 0 {
+			continue
+		}
+
+		if kind, _ := objutils.GetNestedString(obj, "kind"); kind == "List" {
+			items, _ := obj["items"].([]interface{})
+
+			for _, item := range items {
+				if itemObj, ok := item.(map[string]interface{}); ok {
+					res = append(res, itemObj)
+				}
+			}
+
+			continue
+		}
+
+		res = append(res, obj)
+	}
+
+	return res, nil
+}
+
+// getObjectKey returns the key of an object in the form kind/namespace/name, or
+// kind/name if the namespace is empty
+func getObjectKey(obj map[string]interface{}, namespace string) string {
+	kind, _ := objutils.GetNestedString(obj, "kind")
+	name, _ := objutils.GetNestedString(obj, "metadata", "name")
+
+	if namespace == "" {
+		return fmt.Sprintf("%s/%s", kind, name)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// GetObjectsOutput returns a map of objects returned by the API server, keyed by
+// kind/namespace/name, or kind/name for cluster-scoped objects. If flatten is set and
+// there is a single object, the fields of the object are also set at the top level.
+func GetObjectsOutput(objects []map[string]interface{}, flatten bool) map[string]interface{} {
+	res := make(map[string]interface{})
+
+	if flatten && len(objects) == 1 {
+		for key, val := range objects[0] {
+			res[key] = val
+		}
+	}
+
+	for _, obj := range objects {
+		namespace, _ := objutils.GetNestedString(obj, "metadata", "namespace")
+		res[getObjectKey(obj, namespace)] = obj
+	}
+
+	return res
+}
+
+// GetOutputObjects returns the objects in an output returned by GetObjectsOutput, sorted
+// by key. Fields which were set at the top level of the output are skipped.
+func GetOutputObjects(output map[string]interface{}) []map[string]interface{} {
+	keys := make([]string, 0)
+
+	for key, val := range output {
+		obj, ok := val.(map[string]interface{})
+
+		if !ok {
+			continue
+		}
+
+		namespace, _ := objutils.GetNestedString(obj, "metadata", "namespace")
+
+		if key == getObjectKey(obj, namespace) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	res := make([]map[string]interface{}, 0)
+
+	for _, key := range keys {
+		res = append(res, output[key].(map[string]interface{}))
+	}
+
+	return res
+}
+
+// GetObjectsOutputMask returns the mask of the sensitive values in the output returned by
+// GetObjectsOutput for the same objects. The data of Secrets is sensitive, along with the
+// last applied configuration of a Secret, which contains its data.
+func GetObjectsOutputMask(objects []map[string]interface{}, flatten bool) map[string]interface{} {
+	res := make(map[string]interface{})
+
+	if flatten && len(objects) == 1 {
+		for key, val := range getObjectMask(objects[0]) {
+			res[key] = val
+		}
+	}
+
+	for _, obj := range objects {
+		if mask := getObjectMask(obj); mask != nil {
+			namespace, _ := objutils.GetNestedString(obj, "metadata", "namespace")
+			res[getObjectKey(obj, namespace)] = mask
+		}
+	}
+
+	if len(res) == 0 {
+		return nil
+	}
+
+	return res
+}
+
+func getObjectMask(obj map[string]interface{}) map[string]interface{} {
+	if kind, _ := objutils.GetNestedString(obj, "kind"); kind != "Secret" {
+		return nil
+	}
+
+	return map[string]interface{}{
+		"data":       true,
+		"stringData": true,
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				lastAppliedAnnotation: true,
+			},
+		},
+	}
+}
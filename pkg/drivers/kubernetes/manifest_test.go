@@ -0,0 +1,61 @@
+package kubernetes_test
+
+import (
+	"testing"
+
+	"github.com/porter-dev/switchboard/internal/query"
+	"github.com/porter-dev/switchboard/pkg/drivers/kubernetes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetObjectsOutputMask(t *testing.T) {
+	objects := []map[string]interface{}{
+		{
+			"kind": "Secret",
+			"metadata": map[string]interface{}{
+				"name":      "db",
+				"namespace": "apps",
+			},
+			"data": map[string]interface{}{"password": "aHVudGVyMg=="},
+		},
+		{
+			"kind": "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":      "db",
+				"namespace": "apps",
+			},
+			"data": map[string]interface{}{"host": "db.internal"},
+		},
+	}
+
+	output := kubernetes.GetObjectsOutput(objects, false)
+	mask := kubernetes.GetObjectsOutputMask(objects, false)
+
+	redacted := query.Redact(output, mask).(map[string]interface{})
+
+	assert.Equal(t, query.Redacted, redacted["Secret/apps/db"].(map[string]interface{})["data"])
+	assert.Equal(t, output["ConfigMap/apps/db"], redacted["ConfigMap/apps/db"])
+
+	assert.Nil(t, kubernetes.GetObjectsOutputMask(objects[1:], true))
+	assert.Equal(t, true, kubernetes.GetObjectsOutputMask(objects[:1], true)["data"])
+}
+
+func TestGetOutputObjects(t *testing.T) {
+	objects := []map[string]interface{}{
+		{
+			"kind": "Service",
+			"metadata": map[string]interface{}{
+				"name":      "web",
+				"namespace": "apps",
+			},
+		},
+		{
+			"kind":     "Namespace",
+			"metadata": map[string]interface{}{"name": "apps"},
+		},
+	}
+
+	assert.Equal(t, []map[string]interface{}{objects[1], objects[0]}, kubernetes.GetOutputObjects(kubernetes.GetObjectsOutput(objects, true)))
+	assert.Equal(t, objects[:1], kubernetes.GetOutputObjects(kubernetes.GetObjectsOutput(objects[:1], true)))
+	assert.Empty(t, kubernetes.GetOutputObjects(nil))
+}
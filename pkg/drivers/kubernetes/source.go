@@ -1,19 +1,34 @@
 package kubernetes
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/porter-dev/switchboard/utils/objutils"
+)
 
 const (
-	SourceKindNone  string = "none"
-	SourceKindLocal string = "local"
+	SourceKindNone      string = "none"
+	SourceKindLocal     string = "local"
+	SourceKindKustomize string = "kustomize"
 )
 
 type Source struct {
 	*SourceLocal
+	*SourceKustomize
 
 	Kind string
 }
 
 type SourceLocal struct {
+	// Path is a manifest file, or a directory which is read recursively
+	Path string
+
+	// Glob filters the files which are read from a directory by name
+	Glob string
+}
+
+type SourceKustomize struct {
+	// Path is a directory containing a kustomization file
 	Path string
 }
 
@@ -47,6 +62,26 @@ func GetSource(genericSource map[string]interface{}) (*Source, error) {
 		} else if !ok {
 			return nil, fmt.Errorf("source parameter \"path\" is not of type \"string\"")
 		}
+
+		if sourceGlob, sourceGlobExists := genericSource["glob"]; sourceGlobExists {
+			sourceGlobStr, ok := sourceGlob.(string)
+
+			if !ok {
+				return nil, fmt.Errorf("source parameter \"glob\" is not of type \"string\"")
+			}
+
+			res.SourceLocal.Glob = sourceGlobStr
+		}
+	case SourceKindKustomize:
+		sourcePath, err := objutils.GetNestedString(genericSource, "path")
+
+		if err != nil {
+			return nil, fmt.Errorf("source parameter \"path\" must be set to a string when using \"kustomize\" kind")
+		}
+
+		res.SourceKustomize = &SourceKustomize{
+			Path: sourcePath,
+		}
 	}
 
 	return res, nil
@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"github.com/porter-dev/switchboard/utils/objutils"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -16,6 +18,14 @@ type Target struct {
 	Kind      string
 	Namespace string
 	Agent     *Agent
+
+	// PropagationPolicy determines how dependents of an object are garbage
+	// collected when the object is deleted
+	PropagationPolicy metav1.DeletionPropagation
+
+	// ForceConflicts takes ownership of fields which are managed by another field
+	// manager during server-side apply
+	ForceConflicts bool
 }
 
 type TargetLocal struct {
@@ -46,6 +56,25 @@ func GetTarget(genericTarget map[string]interface{}) (*Target, error) {
 		res.Namespace = "default"
 	}
 
+	// look for a propagation policy, which defaults to background deletion
+	propagationPolicy, _ := objutils.GetNestedString(genericTarget, "propagation_policy")
+
+	switch metav1.DeletionPropagation(propagationPolicy) {
+	case "":
+		res.PropagationPolicy = metav1.DeletePropagationBackground
+	case metav1.DeletePropagationBackground, metav1.DeletePropagationForeground, metav1.DeletePropagationOrphan:
+		res.PropagationPolicy = metav1.DeletionPropagation(propagationPolicy)
+	default:
+		return nil, fmt.Errorf("target parameter \"propagation_policy\" must be one of \"Background\", \"Foreground\", or \"Orphan\"")
+	}
+
+	// look for force_conflicts, which defaults to false
+	res.ForceConflicts, err = objutils.GetNestedBool(genericTarget, "force_conflicts")
+
+	if _, ok := err.(*objutils.NestedFieldNotFoundError); err != nil && !ok {
+		return nil, fmt.Errorf("target parameter \"force_conflicts\" must be a boolean")
+	}
+
 	switch res.Kind {
 	case TargetKindLocal:
 		// if the target kind is local, the kubeconfig path and context can be optionally set
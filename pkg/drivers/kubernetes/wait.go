@@ -0,0 +1,274 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/porter-dev/switchboard/internal/query/jsonpath"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/porter-dev/switchboard/utils/objutils"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultWaitTimeout is the maximum duration to wait for if the wait block does not
+// set a timeout
+const defaultWaitTimeout = 5 * time.Minute
+
+// waitInterval is the interval between readiness checks
+const waitInterval = 2 * time.Second
+
+// Wait polls the live objects until every check in the wait block passes, and returns
+// the last observed objects. If the checks do not pass before the timeout, the last
+// observed objects are returned along with an error describing the first object which
+// is not ready.
+func (a *Agent) Wait(ctx context.Context, allApplyOpts []*ApplyOpts, waitOpts *models.Wait) ([]map[string]interface{}, error) {
+	timeout := waitOpts.Timeout
+
+	if timeout == 0 {
+		timeout = defaultWaitTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var objects []map[string]interface{}
+	var notReady string
+
+	err := wait.PollImmediateUntilWithContext(ctx, waitInterval, func(ctx context.Context) (bool, error) {
+		var err error
+
+		objects, notReady, err = a.getNotReady(ctx, allApplyOpts, waitOpts)
+
+		// errors caused by the timeout are reported as a timeout
+		if err != nil && ctx.Err() != nil {
+			return false, nil
+		}
+
+		return notReady == "", err
+	})
+
+	if err == wait.ErrWaitTimeout {
+		return objects, fmt.Errorf("timed out waiting for resource to become ready: %s", notReady)
+	} else if err != nil {
+		return objects, err
+	}
+
+	return objects, nil
+}
+
+// getNotReady returns the live objects along with a reason that the first object is not
+// ready. If every object is ready, the reason is empty. An error is returned if an
+// object cannot become ready, such as a failed job.
+func (a *Agent) getNotReady(
+	ctx context.Context,
+	allApplyOpts []*ApplyOpts,
+	waitOpts *models.Wait,
+) ([]map[string]interface{}, string, error) {
+	objects := make([]map[string]interface{}, 0)
+	notReady := ""
+
+	for _, applyOpts := range allApplyOpts {
+		obj := objutils.CoalesceValues(applyOpts.Base, applyOpts.Config)
+		key := getObjectKey(obj, getObjectNamespace(obj, applyOpts.Target))
+
+		dynResource, name, err := a.getResourceClient(obj, applyOpts.Target)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		live, err := dynResource.Get(ctx, name, metav1.GetOptions{})
+
+		if err != nil && errors.IsNotFound(err) {
+			if notReady == "" {
+				notReady = fmt.Sprintf("%s was not found", key)
+			}
+
+			continue
+		} else if err != nil {
+			return nil, "", fmt.Errorf("error getting %s: %v", key, err)
+		}
+
+		objects = append(objects, live.Object)
+
+		reason, err := getObjectNotReady(live, waitOpts)
+
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %v", key, err)
+		}
+
+		if reason != "" && notReady == "" {
+			notReady = fmt.Sprintf("%s: %s", key, reason)
+		}
+	}
+
+	if notReady == "" && waitOpts.JSONPath != "" {
+		data := GetObjectsOutput(objects, len(allApplyOpts) == 1)
+		res, err := jsonpath.GetResult(data, waitOpts.JSONPath)
+
+		if err != nil {
+			notReady = fmt.Sprintf("query %s returned no result", waitOpts.JSONPath)
+		} else if resStr := fmt.Sprintf("%v", res); waitOpts.Value != "" && resStr != waitOpts.Value {
+			notReady = fmt.Sprintf("query %s returned %s, expected %s", waitOpts.JSONPath, resStr, waitOpts.Value)
+		}
+	}
+
+	return objects, notReady, nil
+}
+
+// getObjectNotReady returns a reason that the object is not ready, or an empty string
+// if it is ready
+func getObjectNotReady(obj *unstructured.Unstructured, waitOpts *models.Wait) (string, error) {
+	kind := obj.GetKind()
+
+	for _, condition := range waitOpts.Conditions {
+		if condition.Kind != "" && condition.Kind != kind {
+			continue
+		}
+
+		status := condition.Status
+
+		if status == "" {
+			status = "True"
+		}
+
+		if getConditionStatus(obj, condition.Type) != status {
+			return fmt.Sprintf("condition %s is not %s", condition.Type, status), nil
+		}
+	}
+
+	if waitOpts.Rollout {
+		switch kind {
+		case "Deployment":
+			return getDeploymentNotReady(obj), nil
+		case "StatefulSet":
+			return getStatefulSetNotReady(obj), nil
+		case "DaemonSet":
+			return getDaemonSetNotReady(obj), nil
+		}
+	}
+
+	if waitOpts.Jobs && kind == "Job" {
+		if getConditionStatus(obj, "Failed") == "True" {
+			return "", fmt.Errorf("job failed")
+		} else if getConditionStatus(obj, "Complete") != "True" {
+			return "job has not completed", nil
+		}
+	}
+
+	return "", nil
+}
+
+// getConditionStatus returns the status of a condition in the object's status, or an
+// empty string if the condition is not set
+func getConditionStatus(obj *unstructured.Unstructured, conditionType string) string {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]interface{})
+
+		if !ok {
+			continue
+		}
+
+		if currType, _ := conditionMap["type"].(string); currType == conditionType {
+			status, _ := conditionMap["status"].(string)
+			return status
+		}
+	}
+
+	return ""
+}
+
+func getObservedNotReady(obj *unstructured.Unstructured) string {
+	observedGeneration, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+
+	if obj.GetGeneration() > observedGeneration {
+		return "waiting for the rollout to be observed"
+	}
+
+	return ""
+}
+
+func getDeploymentNotReady(obj *unstructured.Unstructured) string {
+	if reason := getObservedNotReady(obj); reason != "" {
+		return reason
+	}
+
+	replicas := getSpecReplicas(obj)
+	statusReplicas, _, _ := unstructured.NestedInt64(obj.Object, "status", "replicas")
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+	available, _, _ := unstructured.NestedInt64(obj.Object, "status", "availableReplicas")
+
+	if updated < replicas {
+		return fmt.Sprintf("%d of %d replicas have been updated", updated, replicas)
+	} else if statusReplicas > updated {
+		return fmt.Sprintf("%d old replicas are pending termination", statusReplicas-updated)
+	} else if available < updated {
+		return fmt.Sprintf("%d of %d updated replicas are available", available, updated)
+	}
+
+	return ""
+}
+
+func getStatefulSetNotReady(obj *unstructured.Unstructured) string {
+	if reason := getObservedNotReady(obj); reason != "" {
+		return reason
+	}
+
+	replicas := getSpecReplicas(obj)
+	ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+
+	if ready < replicas {
+		return fmt.Sprintf("%d of %d replicas are ready", ready, replicas)
+	}
+
+	// stateful sets with the OnDelete strategy are not updated until their pods are deleted
+	if strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type"); strategy == "OnDelete" {
+		return ""
+	}
+
+	currentRevision, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	updateRevision, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+
+	if currentRevision != updateRevision {
+		updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+		return fmt.Sprintf("%d of %d replicas have been updated", updated, replicas)
+	}
+
+	return ""
+}
+
+func getDaemonSetNotReady(obj *unstructured.Unstructured) string {
+	if reason := getObservedNotReady(obj); reason != "" {
+		return reason
+	}
+
+	desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedNumberScheduled")
+	available, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberAvailable")
+
+	if updated < desired {
+		return fmt.Sprintf("%d of %d pods have been updated", updated, desired)
+	} else if available < desired {
+		return fmt.Sprintf("%d of %d pods are available", available, desired)
+	}
+
+	return ""
+}
+
+// getSpecReplicas returns the number of desired replicas, which defaults to 1
+func getSpecReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+
+	if !found {
+		return 1
+	}
+
+	return replicas
+}
@@ -0,0 +1,122 @@
+package kubernetes_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/porter-dev/switchboard/pkg/drivers/kubernetes"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newTestAgent(objects ...runtime.Object) *kubernetes.Agent {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}, meta.RESTScopeNamespace)
+
+	scheme := runtime.NewScheme()
+
+	return &kubernetes.Agent{
+		RESTClientGetter: genericclioptions.NewTestConfigFlags().WithRESTMapper(mapper),
+		DynamicClientset: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+			{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+			{Group: "batch", Version: "v1", Resource: "jobs"}:       "JobList",
+		}, objects...),
+	}
+}
+
+func newTestObject(apiVersion, kind string, spec, status map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":       "web",
+				"namespace":  "default",
+				"generation": int64(2),
+			},
+			"spec":   spec,
+			"status": status,
+		},
+	}
+}
+
+func getTestApplyOpts(obj *unstructured.Unstructured) []*kubernetes.ApplyOpts {
+	return []*kubernetes.ApplyOpts{{
+		Base:   obj.DeepCopy().Object,
+		Target: &kubernetes.Target{Namespace: "default"},
+	}}
+}
+
+func TestWaitRolloutComplete(t *testing.T) {
+	deployment := newTestObject("apps/v1", "Deployment", map[string]interface{}{
+		"replicas": int64(2),
+	}, map[string]interface{}{
+		"observedGeneration": int64(2),
+		"replicas":           int64(2),
+		"updatedReplicas":    int64(2),
+		"availableReplicas":  int64(2),
+		"readyReplicas":      int64(2),
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "Available", "status": "True"},
+		},
+	})
+
+	agent := newTestAgent(deployment)
+
+	objects, err := agent.Wait(context.Background(), getTestApplyOpts(deployment), &models.Wait{
+		Rollout: true,
+		Conditions: []*models.WaitCondition{
+			{Type: "Available"},
+		},
+		JSONPath: "{ .status.readyReplicas }",
+		Value:    "2",
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+}
+
+func TestWaitRolloutTimeout(t *testing.T) {
+	deployment := newTestObject("apps/v1", "Deployment", map[string]interface{}{
+		"replicas": int64(3),
+	}, map[string]interface{}{
+		"observedGeneration": int64(2),
+		"replicas":           int64(3),
+		"updatedReplicas":    int64(3),
+		"availableReplicas":  int64(1),
+	})
+
+	agent := newTestAgent(deployment)
+
+	_, err := agent.Wait(context.Background(), getTestApplyOpts(deployment), &models.Wait{
+		Rollout: true,
+		Timeout: 100 * time.Millisecond,
+	})
+
+	assert.EqualError(t, err, "timed out waiting for resource to become ready: Deployment/default/web: 1 of 3 updated replicas are available")
+}
+
+func TestWaitJobFailed(t *testing.T) {
+	job := newTestObject("batch/v1", "Job", map[string]interface{}{}, map[string]interface{}{
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "Failed", "status": "True"},
+		},
+	})
+
+	agent := newTestAgent(job)
+
+	_, err := agent.Wait(context.Background(), getTestApplyOpts(job), &models.Wait{
+		Jobs: true,
+	})
+
+	assert.EqualError(t, err, "Job/default/web: job failed")
+}
@@ -5,29 +5,56 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/porter-dev/switchboard/pkg/drivers"
 	"github.com/porter-dev/switchboard/pkg/models"
-
-	hcljson "github.com/hashicorp/hcl2/hcl/json"
+	"github.com/rs/zerolog"
 )
 
 type Driver struct {
+	resourceName string
+	logger       *zerolog.Logger
+
 	source      *Source
+	target      *Target
 	output      map[string]interface{}
 	lookupTable *map[string]drivers.Driver
-	varFilePath string
 	tf          *tfexec.Terraform
+
+	// dataDir is the Terraform data directory of the resource, which is passed to every
+	// command as TF_DATA_DIR
+	dataDir string
+
+	// sensitiveOutput marks the planned outputs which are sensitive
+	sensitiveOutput map[string]interface{}
+
+	// snapshot is the state recorded by Checkpoint
+	snapshot *tfjson.State
+
+	// cacheDir and baseDir are used to fetch module sources. A module source is fetched
+	// once per driver, but the fetch is retried if it failed.
+	cacheDir  string
+	baseDir   string
+	fetchMu   sync.Mutex
+	isFetched bool
 }
 
 func NewTerraformDriver(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
 	driver := &Driver{
-		lookupTable: opts.DriverLookupTable,
+		resourceName: resource.Name,
+		logger:       opts.Logger,
+		lookupTable:  opts.DriverLookupTable,
+	}
+
+	if driver.logger == nil {
+		nopLogger := zerolog.Nop()
+		driver.logger = &nopLogger
 	}
 
 	source, err := GetSource(resource.Source)
@@ -36,53 +63,98 @@ func NewTerraformDriver(resource *models.Resource, opts *drivers.SharedDriverOpt
 		return nil, err
 	}
 
-	err = driver.initSource(source, opts)
+	driver.target, err = GetTarget(resource.Target)
 
 	if err != nil {
 		return nil, err
 	}
 
-	driver.source = source
+	err = driver.initSource(resource, source, opts)
 
-	if source.VarMethod == VarMethodFile {
-		// construct the var file path
-		if filepath.IsAbs(source.Path) {
-			driver.varFilePath = filepath.Join(source.Path, "tfvars.json")
-		} else {
-			driver.varFilePath = filepath.Join(opts.BaseDir, source.Path, "tfvars.json")
-		}
+	if err != nil {
+		return nil, err
 	}
 
+	driver.source = source
+
 	return driver, nil
 }
 
-func (d *Driver) initSource(source *Source, opts *drivers.SharedDriverOpts) error {
-	// read the file and set the base variable
+func (d *Driver) initSource(resource *models.Resource, source *Source, opts *drivers.SharedDriverOpts) error {
+	var workDir string
+
 	switch source.Kind {
 	case SourceKindLocal:
-		tf, err := tfexec.NewTerraform(source.SourceLocal.Path, "terraform")
+		workDir = source.SourceLocal.Path
+
+		if !filepath.IsAbs(workDir) {
+			workDir = filepath.Join(opts.BaseDir, workDir)
+		}
+	case SourceKindModule:
+		if opts.CacheDir == "" {
+			return fmt.Errorf("a cache directory must be set to use the \"module\" source kind")
+		}
+
+		// the module is fetched into the working directory when the driver is initialized
+		workDir = GetWorkDir(opts.CacheDir, opts.BaseDir, resource.Name)
+		d.cacheDir = opts.CacheDir
+		d.baseDir = opts.BaseDir
+
+		err := os.MkdirAll(workDir, 0700)
 
 		if err != nil {
-			log.Fatalf("error running NewTerraform: %s", err)
+			return fmt.Errorf("error creating working directory: %v", err)
 		}
+	}
 
-		// TODO: don't set these to os stdout or stderr necessary, we probably want a json parser
-		// of sorts
-		tf.SetStderr(os.Stderr)
+	tf, err := tfexec.NewTerraform(workDir, "terraform")
 
-		d.tf = tf
+	if err != nil {
+		return fmt.Errorf("error running NewTerraform: %v", err)
+	}
+
+	// resources which use the same module directory would otherwise share the selected
+	// workspace and backend configuration, which are stored in the data directory
+	// the data directory is absolute, since commands are run in the working directory
+	d.dataDir, err = filepath.Abs(GetDataDir(workDir, resource.Name))
+
+	if err != nil {
+		return fmt.Errorf("error getting data directory: %v", err)
 	}
 
+	err = os.MkdirAll(d.dataDir, 0700)
+
+	if err != nil {
+		return fmt.Errorf("error creating data directory: %v", err)
+	}
+
+	err = tf.SetEnv(getTFExecEnv(d.dataDir))
+
+	if err != nil {
+		return fmt.Errorf("error setting Terraform environment: %v", err)
+	}
+
+	d.tf = tf
+
 	return nil
 }
 
-func (d *Driver) ShouldApply(resource *models.Resource) bool {
-	return true
+// ShouldApply returns false if planning the resource results in no changes. In
+// that case, the output is set from the plan.
+func (d *Driver) ShouldApply(ctx context.Context, resource *models.Resource) bool {
+	plan, err := d.Plan(ctx, resource)
+
+	if err != nil {
+		return true
+	}
+
+	return plan.Action != drivers.PlanActionNoop
 }
 
-func (d *Driver) Apply(resource *models.Resource) (*models.Resource, error) {
-	config, err := drivers.ConstructConfig(&drivers.ConstructConfigOpts{
+func (d *Driver) Apply(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
 		RawConf:      resource.Config,
+		RawConfMask:  resource.ConfigMask,
 		LookupTable:  *d.lookupTable,
 		Dependencies: resource.Dependencies,
 	})
@@ -91,123 +163,381 @@ func (d *Driver) Apply(resource *models.Resource) (*models.Resource, error) {
 		return nil, err
 	}
 
-	err = d.tf.Init(context.Background(), tfexec.Upgrade(true))
+	err = d.init(ctx)
 
 	if err != nil {
 		return nil, err
 	}
 
-	applyOpts, err := d.getVarOpts(config)
+	varFile, cleanup, err := d.writeVarFile(config)
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = d.tf.Apply(context.Background(), applyOpts...)
+	defer cleanup()
+
+	_, err = d.runJSON(ctx, "apply", "-json", "-no-color", "-input=false", "-auto-approve", "-var-file="+varFile)
 
 	if err != nil {
 		return nil, err
 	}
 
+	// clear any planned output, so that the output is read from the state
+	d.output = nil
+
 	return resource, nil
 }
 
-// Output returns the created TF output
-func (d *Driver) Output() (map[string]interface{}, error) {
-	output, err := d.tf.Output(context.Background())
+func (d *Driver) Delete(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
+		RawConf:      resource.Config,
+		RawConfMask:  resource.ConfigMask,
+		LookupTable:  *d.lookupTable,
+		Dependencies: resource.Dependencies,
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	keyToVal := make(map[string]interface{})
+	err = d.init(ctx)
 
-	for key, meta := range output {
-		keyToVal[key] = meta.Value
+	if err != nil {
+		return nil, err
 	}
 
-	// not the most efficient, but marshal to json and decode again
-	res := make(map[string]interface{})
-
-	rawBytes, err := json.Marshal(keyToVal)
+	varFile, cleanup, err := d.writeVarFile(config)
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = json.Unmarshal(rawBytes, &res)
+	defer cleanup()
+
+	_, err = d.runJSON(ctx, "apply", "-destroy", "-json", "-no-color", "-input=false", "-auto-approve", "-var-file="+varFile)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return res, nil
+	d.output = nil
+
+	return resource, nil
 }
 
-// setVars sets variables for the Terraform process through
-// either a var file or env variables.
-func (d *Driver) getVarOpts(config map[string]interface{}) ([]tfexec.ApplyOption, error) {
-	applyOpts := make([]tfexec.ApplyOption, 0)
+func (d *Driver) Plan(ctx context.Context, resource *models.Resource) (*drivers.Plan, error) {
+	config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
+		RawConf:      resource.Config,
+		RawConfMask:  resource.ConfigMask,
+		LookupTable:  *d.lookupTable,
+		Dependencies: resource.Dependencies,
+	})
 
-	if d.source.VarMethod == VarMethodFile {
-		applyOpts = append(applyOpts, tfexec.VarFile(d.varFilePath))
+	if err != nil {
+		return nil, err
 	}
 
-	switch d.source.VarMethod {
-	case VarMethodEnv:
-		for key, val := range config {
-			valBytes, err := toHCL(val)
+	err = d.init(ctx)
 
-			if err != nil {
-				return nil, err
+	if err != nil {
+		return nil, err
+	}
+
+	varFile, cleanup, err := d.writeVarFile(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cleanup()
+
+	// the plan file contains the values of variables, so it is written to the data
+	// directory as well
+	planDir, err := ioutil.TempDir(d.dataDir, "plan-")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(planDir)
+
+	planPath := filepath.Join(planDir, "tfplan")
+	planArgs := []string{"plan", "-json", "-no-color", "-input=false", "-detailed-exitcode", "-out=" + planPath}
+
+	// with -detailed-exitcode, an exit code of 2 means that the plan has changes
+	exitCode, err := d.runJSON(ctx, append(planArgs, "-var-file="+varFile)...)
+
+	if err != nil && exitCode != 2 {
+		return nil, err
+	}
+
+	hasChanges := exitCode == 2
+
+	tfPlan, err := d.tf.ShowPlanFile(ctx, planPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// set the planned output values, so that dependents can be planned. Unknown
+	// output values are not included in the planned values.
+	d.output = make(map[string]interface{})
+	d.sensitiveOutput = make(map[string]interface{})
+
+	if tfPlan.PlannedValues != nil {
+		for key, output := range tfPlan.PlannedValues.Outputs {
+			d.output[key] = output.Value
+
+			if output.Sensitive {
+				d.sensitiveOutput[key] = true
 			}
+		}
+	}
+
+	return getPlan(tfPlan, hasChanges), nil
+}
+
+// Checkpoint records a snapshot of the Terraform state, so that it can be restored by
+// Rollback
+func (d *Driver) Checkpoint(ctx context.Context, resource *models.Resource) error {
+	err := d.init(ctx)
 
-			applyOpts = append(applyOpts, tfexec.Var(fmt.Sprintf("%s=%s", key, string(valBytes))))
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := d.tf.Show(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	d.snapshot = snapshot
+
+	return nil
+}
+
+// Rollback destroys the module if the state snapshot was empty. Otherwise, the module
+// is applied again with the variables it was last applied with, which restores the
+// resources tracked by the snapshot. If those variables are unknown, the module cannot
+// be rolled back, since applying it with the current variables would not restore it.
+func (d *Driver) Rollback(ctx context.Context, current, previous *models.Resource) error {
+	if d.snapshot == nil {
+		return fmt.Errorf("no checkpoint was recorded for resource %s", current.Name)
+	}
+
+	if isEmptyState(d.snapshot) {
+		_, err := d.Delete(ctx, current)
+		return err
+	}
+
+	if previous == nil {
+		return fmt.Errorf(
+			"cannot roll back resource %s: the config it was previously applied with is not recorded in the state, "+
+				"or its encrypted values have changed since it was applied",
+			current.Name,
+		)
+	}
+
+	_, err := d.Apply(ctx, previous)
+
+	return err
+}
+
+// isEmptyState returns true if the state does not track any resources
+func isEmptyState(st *tfjson.State) bool {
+	if st.Values == nil || st.Values.RootModule == nil {
+		return true
+	}
+
+	return len(st.Values.RootModule.Resources) == 0 && len(st.Values.RootModule.ChildModules) == 0
+}
+
+// getPlan summarizes the resource changes in a Terraform plan
+func getPlan(tfPlan *tfjson.Plan, hasChanges bool) *drivers.Plan {
+	res := &drivers.Plan{
+		Action: drivers.PlanActionNoop,
+	}
+
+	if !hasChanges {
+		return res
+	}
+
+	res.Action = drivers.PlanActionCreate
+
+	var diff strings.Builder
+
+	for _, change := range tfPlan.ResourceChanges {
+		if change.Change == nil || change.Change.Actions.NoOp() || change.Change.Actions.Read() {
+			continue
 		}
-	case VarMethodFile:
-		file, err := json.Marshal(config)
 
-		if err != nil {
-			return nil, err
+		// if any resource is not being created, the Terraform module is being updated
+		if !change.Change.Actions.Create() {
+			res.Action = drivers.PlanActionUpdate
 		}
 
-		err = ioutil.WriteFile(d.varFilePath, file, 0644)
+		actions := make([]string, 0)
+
+		for _, action := range change.Change.Actions {
+			actions = append(actions, string(action))
+		}
+
+		diff.WriteString(fmt.Sprintf("%s: %s\n", change.Address, strings.Join(actions, ", ")))
+	}
+
+	for name, change := range tfPlan.OutputChanges {
+		if change == nil || change.Actions.NoOp() {
+			continue
+		}
+
+		actions := make([]string, 0)
+
+		for _, action := range change.Actions {
+			actions = append(actions, string(action))
+		}
+
+		diff.WriteString(fmt.Sprintf("output.%s: %s\n", name, strings.Join(actions, ", ")))
+	}
+
+	res.Diff = diff.String()
+
+	return res
+}
+
+// Output returns the created TF output
+func (d *Driver) Output(ctx context.Context) (map[string]interface{}, error) {
+	output, _, err := d.getOutput(ctx)
+
+	return output, err
+}
+
+// SensitiveOutput returns a mask of the outputs which are declared as sensitive
+func (d *Driver) SensitiveOutput(ctx context.Context) (map[string]interface{}, error) {
+	_, sensitive, err := d.getOutput(ctx)
+
+	return sensitive, err
+}
+
+// SensitiveConfig returns a mask of the config values which set variables that are
+// declared as sensitive. If the source is a module, it is fetched first, so that its
+// variables can be read.
+func (d *Driver) SensitiveConfig(ctx context.Context, resource *models.Resource) (map[string]interface{}, error) {
+	if d.source.SourceModule != nil {
+		err := d.fetchModuleOnce(ctx)
 
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	variables, err := ReadVariables(d.tf.WorkingDir())
 
-		applyOpts = append(applyOpts, tfexec.VarFile(d.varFilePath))
+	if err != nil {
+		return nil, err
 	}
 
-	return applyOpts, nil
+	res := make(map[string]interface{})
+
+	for name := range resource.Config {
+		if variable, ok := variables[name]; ok && variable.Sensitive {
+			res[name] = true
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	return res, nil
 }
 
-func toHCL(val interface{}) ([]byte, error) {
-	jsonValBytes, err := json.Marshal(val)
+// getOutput returns the planned output if the module was planned, or the output read
+// from the state otherwise, along with a mask of the sensitive outputs
+func (d *Driver) getOutput(ctx context.Context) (map[string]interface{}, map[string]interface{}, error) {
+	if d.output != nil {
+		return d.output, d.sensitiveOutput, nil
+	}
+
+	output, err := d.tf.Output(ctx)
 
 	if err != nil {
-		return []byte{}, err
+		return nil, nil, err
 	}
 
-	switch val.(type) {
-	case map[string]interface{}:
-	case []interface{}:
-		// this is pretty annoying, but we first marshal into json and
-		// from there HCL
-		hclFile, err := hcljson.Parse(jsonValBytes, "")
+	keyToVal := make(map[string]interface{})
+	sensitive := make(map[string]interface{})
 
-		if err != nil {
-			return []byte{}, err
+	for key, meta := range output {
+		keyToVal[key] = meta.Value
+
+		if meta.Sensitive {
+			sensitive[key] = true
 		}
+	}
+
+	// not the most efficient, but marshal to json and decode again
+	res := make(map[string]interface{})
+
+	rawBytes, err := json.Marshal(keyToVal)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = json.Unmarshal(rawBytes, &res)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return res, sensitive, nil
+}
+
+// writeVarFile validates the config against the variables declared by the module, and
+// writes it to a temporary var file in the resource's data directory, which only the
+// current user can read. The returned function removes the var file.
+func (d *Driver) writeVarFile(config map[string]interface{}) (string, func(), error) {
+	variables, err := ReadVariables(d.tf.WorkingDir())
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = ValidateConfig(variables, config, d.tf.WorkingDir())
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	fileBytes, err := json.Marshal(config)
 
-		return hclFile.Bytes, nil
-	case string:
-		// in the case of a pure string, we return unquoted.
-		return []byte(strings.Trim(string(jsonValBytes), "\"")), nil
+	if err != nil {
+		return "", nil, err
+	}
+
+	// ioutil.TempFile creates the file with 0600 permissions
+	file, err := ioutil.TempFile(d.dataDir, "vars-*.tfvars.json")
+
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating var file: %v", err)
+	}
+
+	cleanup := func() {
+		os.Remove(file.Name())
+	}
+
+	_, err = file.Write(fileBytes)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("error writing var file: %v", err)
 	}
 
-	// in the default case (string, int), we just return raw json,
-	// it should be valid
-	return jsonValBytes, nil
+	return file.Name(), cleanup, nil
 }
@@ -0,0 +1,172 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+)
+
+// init fetches the module if the source is a module, initializes the resource's data
+// directory with the target's backend configuration, and selects the target's workspace.
+//
+// Init is run directly rather than through tfexec, since tfexec always passes
+// -force-copy, which migrates state whenever the backend configuration changes.
+// Without reconfigure or migrate_state, a changed backend configuration is an error.
+func (d *Driver) init(ctx context.Context) error {
+	if d.source.SourceModule != nil {
+		err := d.fetchModuleOnce(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		err = checkRemoteBackend(d.tf.WorkingDir())
+
+		if err != nil {
+			return err
+		}
+	}
+
+	backendConfigFile, cleanup, err := d.target.writeBackendConfigFile()
+
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, d.tf.ExecPath(), d.target.getInitArgs(backendConfigFile)...)
+	cmd.Dir = d.tf.WorkingDir()
+	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1", "TF_DATA_DIR="+d.dataDir)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+
+	if err != nil {
+		return fmt.Errorf(
+			"terraform init failed: %v: %s",
+			err,
+			d.target.redactBackendConfig(strings.TrimSpace(stderr.String())),
+		)
+	}
+
+	if d.target.Workspace == "" {
+		return nil
+	}
+
+	return d.selectWorkspace(ctx, d.target.Workspace)
+}
+
+// fetchModuleOnce fetches the module source into the working directory, unless it was
+// already fetched successfully. Failures are not recorded, so that a fetch which failed
+// because its context was cancelled is retried with the next context.
+func (d *Driver) fetchModuleOnce(ctx context.Context) error {
+	d.fetchMu.Lock()
+	defer d.fetchMu.Unlock()
+
+	if d.isFetched {
+		return nil
+	}
+
+	err := FetchModule(ctx, d.source.SourceModule, d.cacheDir, d.baseDir, d.tf.WorkingDir())
+
+	if err != nil {
+		return err
+	}
+
+	d.isFetched = true
+
+	return nil
+}
+
+// checkRemoteBackend returns an error if a fetched module does not declare a remote
+// backend. Fetched modules are applied in a working directory inside the cache directory,
+// so local state would be lost when the cache is removed, or when the resource group is
+// applied from another directory.
+func checkRemoteBackend(workDir string) error {
+	backend, err := ReadBackend(workDir)
+
+	if err != nil {
+		return err
+	}
+
+	if backend == "" || backend == "local" {
+		return fmt.Errorf("modules using a \"module\" source must declare a remote backend, since local state would be stored in the cache directory")
+	}
+
+	return nil
+}
+
+// selectWorkspace selects the workspace, creating it if it does not exist. The selection
+// is written to the resource's data directory, and is only read by the commands which
+// are run through tfexec, since tfexec does not allow TF_WORKSPACE to be set. Commands
+// which are run directly are passed TF_WORKSPACE instead.
+func (d *Driver) selectWorkspace(ctx context.Context, workspace string) error {
+	workspaces, current, err := d.tf.WorkspaceList(ctx)
+
+	if err != nil {
+		return fmt.Errorf("error listing workspaces: %v", err)
+	}
+
+	if current == workspace {
+		return nil
+	}
+
+	for _, existing := range workspaces {
+		if existing == workspace {
+			err = d.tf.WorkspaceSelect(ctx, workspace)
+
+			if err != nil {
+				return fmt.Errorf("error selecting workspace %s: %v", workspace, err)
+			}
+
+			return nil
+		}
+	}
+
+	// creating a workspace also selects it
+	err = d.tf.WorkspaceNew(ctx, workspace)
+
+	if err != nil {
+		return fmt.Errorf("error creating workspace %s: %v", workspace, err)
+	}
+
+	return nil
+}
+
+// GetDataDir returns the Terraform data directory of a resource, inside the working
+// directory. The directory is unique to the resource name, since several resources can
+// use the same working directory.
+func GetDataDir(workDir, resourceName string) string {
+	sum := sha256.Sum256([]byte(resourceName))
+
+	return filepath.Join(workDir, ".terraform", "switchboard", hex.EncodeToString(sum[:]))
+}
+
+// getTFExecEnv returns the environment of the commands which are run through tfexec.
+// Variables which tfexec does not allow to be set are removed, since tfexec sets them.
+func getTFExecEnv(dataDir string) map[string]string {
+	env := make(map[string]string)
+
+	for _, keyVal := range os.Environ() {
+		parts := strings.SplitN(keyVal, "=", 2)
+
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	env["TF_DATA_DIR"] = dataDir
+
+	return tfexec.CleanEnv(env)
+}
@@ -0,0 +1,308 @@
+package terraform
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// cacheSubdir is the directory inside the cache directory which stores Terraform data
+const cacheSubdir = "terraform"
+
+// preservedFiles are the files in a working directory which are kept when the module is
+// fetched again, so that providers and backend configuration are not lost between
+// applies. They are also never copied from the module, so that state files which were
+// committed to the module are never used.
+var preservedFiles = map[string]bool{
+	".terraform":               true,
+	"terraform.tfstate":        true,
+	"terraform.tfstate.backup": true,
+	"terraform.tfstate.d":      true,
+}
+
+// gitCacheLocks serializes access to each cached git repository, so that resources
+// which use the same repository can be fetched concurrently
+var gitCacheLocks sync.Map
+
+// GetWorkDir returns the working directory of a resource which uses a module source. The
+// directory is unique to the resource name and the base directory of the resource group.
+func GetWorkDir(cacheDir, baseDir, resourceName string) string {
+	sum := sha256.Sum256([]byte(baseDir + "\n" + resourceName))
+
+	return filepath.Join(cacheDir, cacheSubdir, "workdirs", hex.EncodeToString(sum[:]))
+}
+
+// ClearCache removes the git repositories cached by the Terraform driver. Working
+// directories are not removed, since they contain the installed providers of each
+// resource.
+func ClearCache(cacheDir string) error {
+	err := os.RemoveAll(filepath.Join(cacheDir, cacheSubdir, "git"))
+
+	if err != nil {
+		return fmt.Errorf("error clearing Terraform cache: %v", err)
+	}
+
+	return nil
+}
+
+// FetchModule fetches the module into the working directory. Files from a previous
+// fetch are replaced, except for the Terraform data directory and local state.
+// Relative archive paths are resolved relative to the base directory.
+func FetchModule(ctx context.Context, module *SourceModule, cacheDir, baseDir, workDir string) error {
+	tmpRoot := filepath.Join(cacheDir, cacheSubdir, "tmp")
+
+	err := os.MkdirAll(tmpRoot, 0700)
+
+	if err != nil {
+		return fmt.Errorf("error creating module cache directory: %v", err)
+	}
+
+	tmpDir, err := ioutil.TempDir(tmpRoot, "module-")
+
+	if err != nil {
+		return fmt.Errorf("error creating module directory: %v", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	if module.Git != "" {
+		err = fetchGit(ctx, module.Git, module.Ref, filepath.Join(cacheDir, cacheSubdir, "git"), tmpDir)
+	} else {
+		archivePath := module.Archive
+
+		if !filepath.IsAbs(archivePath) {
+			archivePath = filepath.Join(baseDir, archivePath)
+		}
+
+		err = extractArchive(archivePath, tmpDir)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	moduleDir := filepath.Join(tmpDir, module.Subdir)
+
+	if info, err := os.Stat(moduleDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("module directory %s was not found in the source", module.Subdir)
+	}
+
+	return syncWorkDir(moduleDir, workDir)
+}
+
+// fetchGit checks out a ref of a git repository into the destination directory. The
+// repository is cached as a bare repository, so that only new objects are fetched on
+// subsequent fetches.
+func fetchGit(ctx context.Context, url, ref, gitCacheDir, dst string) error {
+	sum := sha256.Sum256([]byte(url))
+	repoDir := filepath.Join(gitCacheDir, hex.EncodeToString(sum[:]))
+
+	lock, _ := gitCacheLocks.LoadOrStore(repoDir, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if _, err := os.Stat(repoDir); os.IsNotExist(err) {
+		err = runGit(ctx, "init", "--bare", "--quiet", repoDir)
+
+		if err != nil {
+			return fmt.Errorf("error creating git cache for %s: %v", url, err)
+		}
+	}
+
+	fetchArgs := []string{"--git-dir", repoDir, "fetch", "--quiet", "--depth", "1", url}
+
+	if ref != "" {
+		fetchArgs = append(fetchArgs, ref)
+	}
+
+	err := runGit(ctx, fetchArgs...)
+
+	if err != nil {
+		return fmt.Errorf("error fetching module from %s: %v", url, err)
+	}
+
+	err = runGit(ctx, "--git-dir", repoDir, "--work-tree", dst, "checkout", "--quiet", "--force", "FETCH_HEAD", "--", ".")
+
+	if err != nil {
+		return fmt.Errorf("error checking out module from %s: %v", url, err)
+	}
+
+	return nil
+}
+
+func runGit(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+
+	// never prompt for credentials, since switchboard runs non-interactively
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// extractArchive extracts a tarball, which may be gzipped, into the destination
+// directory. Only directories and regular files are extracted.
+func extractArchive(path, dst string) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return fmt.Errorf("error opening module archive: %v", err)
+	}
+
+	defer file.Close()
+
+	var reader io.Reader = file
+
+	if strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz") {
+		gzipReader, err := gzip.NewReader(file)
+
+		if err != nil {
+			return fmt.Errorf("error reading module archive %s: %v", path, err)
+		}
+
+		defer gzipReader.Close()
+
+		reader = gzipReader
+	} else if !strings.HasSuffix(path, ".tar") {
+		return fmt.Errorf("module archive %s must be a .tar.gz, .tgz or .tar file", path)
+	}
+
+	tarReader := tar.NewReader(reader)
+
+	for {
+		header, err := tarReader.Next()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error reading module archive %s: %v", path, err)
+		}
+
+		target := filepath.Join(dst, filepath.Clean("/"+header.Name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = writeArchiveFile(tarReader, target, os.FileMode(header.Mode).Perm())
+		}
+
+		if err != nil {
+			return fmt.Errorf("error extracting %s from module archive: %v", header.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func writeArchiveFile(reader io.Reader, path string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0600)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, reader)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// syncWorkDir replaces the module files in the working directory with the files in the
+// module directory
+func syncWorkDir(moduleDir, workDir string) error {
+	err := os.MkdirAll(workDir, 0700)
+
+	if err != nil {
+		return fmt.Errorf("error creating working directory: %v", err)
+	}
+
+	entries, err := ioutil.ReadDir(workDir)
+
+	if err != nil {
+		return fmt.Errorf("error reading working directory: %v", err)
+	}
+
+	for _, entry := range entries {
+		if preservedFiles[entry.Name()] {
+			continue
+		}
+
+		err = os.RemoveAll(filepath.Join(workDir, entry.Name()))
+
+		if err != nil {
+			return fmt.Errorf("error cleaning working directory: %v", err)
+		}
+	}
+
+	return filepath.Walk(moduleDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(moduleDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		if relPath != "." && preservedFiles[strings.Split(relPath, string(filepath.Separator))[0]] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		// the git metadata of the checkout is not part of the module
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		target := filepath.Join(workDir, relPath)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, 0700)
+		} else if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		return writeArchiveFile(file, target, info.Mode().Perm())
+	})
+}
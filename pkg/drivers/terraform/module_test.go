@@ -0,0 +1,175 @@
+package terraform_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/drivers"
+	"github.com/porter-dev/switchboard/pkg/drivers/terraform"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestArchive(t *testing.T, path string, files map[string]string) {
+	file, err := os.Create(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+
+	for name, contents := range files {
+		err = tarWriter.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(contents)),
+			Typeflag: tar.TypeReg,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tarWriter.Write([]byte(contents))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	fileBytes, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(fileBytes)
+}
+
+func TestFetchModuleArchive(t *testing.T) {
+	baseDir := t.TempDir()
+	cacheDir := t.TempDir()
+	workDir := terraform.GetWorkDir(cacheDir, baseDir, "rds")
+
+	writeTestArchive(t, filepath.Join(baseDir, "module.tar.gz"), map[string]string{
+		"modules/rds/main.tf": "# v1",
+		"modules/rds/old.tf":  "# removed in v2",
+		"../../escape.tf":     "# outside of the archive",
+	})
+
+	module := &terraform.SourceModule{
+		Archive: "module.tar.gz",
+		Subdir:  "modules/rds",
+	}
+
+	err := terraform.FetchModule(context.Background(), module, cacheDir, baseDir, workDir)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "# v1", readTestFile(t, filepath.Join(workDir, "main.tf")))
+
+	// local state is kept when the module is fetched again, while removed files are
+	// deleted
+	err = ioutil.WriteFile(filepath.Join(workDir, "terraform.tfstate"), []byte("{}"), 0600)
+
+	assert.NoError(t, err)
+
+	writeTestArchive(t, filepath.Join(baseDir, "module.tar.gz"), map[string]string{
+		"modules/rds/main.tf": "# v2",
+	})
+
+	err = terraform.FetchModule(context.Background(), module, cacheDir, baseDir, workDir)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "# v2", readTestFile(t, filepath.Join(workDir, "main.tf")))
+	assert.Equal(t, "{}", readTestFile(t, filepath.Join(workDir, "terraform.tfstate")))
+	assert.NoFileExists(t, filepath.Join(workDir, "old.tf"))
+	assert.NoFileExists(t, filepath.Join(cacheDir, "escape.tf"))
+}
+
+func TestFetchModuleGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repoDir := t.TempDir()
+
+	runGit := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repoDir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+	}
+
+	runGit("init", "--quiet")
+
+	err := ioutil.WriteFile(filepath.Join(repoDir, "main.tf"), []byte("# v1"), 0644)
+
+	assert.NoError(t, err)
+
+	runGit("add", ".")
+	runGit("commit", "--quiet", "-m", "v1")
+	runGit("tag", "v1")
+
+	err = ioutil.WriteFile(filepath.Join(repoDir, "main.tf"), []byte("# v2"), 0644)
+
+	assert.NoError(t, err)
+
+	runGit("commit", "--quiet", "-am", "v2")
+
+	cacheDir := t.TempDir()
+	workDir := terraform.GetWorkDir(cacheDir, "", "rds")
+
+	err = terraform.FetchModule(context.Background(), &terraform.SourceModule{
+		Git: "file://" + repoDir,
+		Ref: "v1",
+	}, cacheDir, "", workDir)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "# v1", readTestFile(t, filepath.Join(workDir, "main.tf")))
+	assert.NoDirExists(t, filepath.Join(workDir, ".git"))
+}
+
+func TestModuleSourceRequiresRemoteBackend(t *testing.T) {
+	baseDir := t.TempDir()
+	lookupTable := make(map[string]drivers.Driver)
+
+	writeTestArchive(t, filepath.Join(baseDir, "module.tar.gz"), map[string]string{
+		"main.tf": variablesTF,
+	})
+
+	driver, err := terraform.NewTerraformDriver(&models.Resource{
+		Name: "rds",
+		Source: map[string]interface{}{
+			"kind":    "module",
+			"archive": "module.tar.gz",
+		},
+	}, &drivers.SharedDriverOpts{
+		BaseDir:           baseDir,
+		CacheDir:          t.TempDir(),
+		DriverLookupTable: &lookupTable,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = driver.Plan(context.Background(), &models.Resource{Name: "rds"})
+
+	assert.EqualError(t, err, "modules using a \"module\" source must declare a remote backend, since local state would be stored in the cache directory")
+}
@@ -0,0 +1,193 @@
+package terraform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// maxEventSize is the maximum size of a single line of Terraform's JSON output
+const maxEventSize = 1024 * 1024
+
+// event is a message in Terraform's machine-readable UI output
+type event struct {
+	Level   string `json:"@level"`
+	Message string `json:"@message"`
+	Type    string `json:"type"`
+
+	// Hook is set on apply_*, refresh_* and provision_* events
+	Hook *struct {
+		Resource *eventResource `json:"resource"`
+		Action   string         `json:"action"`
+	} `json:"hook"`
+
+	// Change is set on planned_change and resource_drift events
+	Change *struct {
+		Resource *eventResource `json:"resource"`
+		Action   string         `json:"action"`
+	} `json:"change"`
+
+	// Diagnostic is set on diagnostic events
+	Diagnostic *eventDiagnostic `json:"diagnostic"`
+}
+
+type eventResource struct {
+	Addr string `json:"addr"`
+}
+
+type eventDiagnostic struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail"`
+	Address  string `json:"address"`
+}
+
+func (e *eventDiagnostic) String() string {
+	if e.Detail == "" {
+		return e.Summary
+	}
+
+	return fmt.Sprintf("%s: %s", e.Summary, e.Detail)
+}
+
+// runJSON runs a Terraform command with machine-readable UI output, and re-emits each
+// event through the driver's logger. If the command fails, the error diagnostics are
+// returned as the error. The exit code is returned along with the error, since some
+// commands use it to report results.
+//
+// Commands are run directly rather than through tfexec, since tfexec does not support
+// JSON output for apply and destroy.
+func (d *Driver) runJSON(ctx context.Context, args ...string) (int, error) {
+	cmd := exec.CommandContext(ctx, d.tf.ExecPath(), args...)
+	cmd.Dir = d.tf.WorkingDir()
+	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1", "TF_INPUT=0", "TF_DATA_DIR="+d.dataDir)
+
+	if d.target.Workspace != "" {
+		cmd.Env = append(cmd.Env, "TF_WORKSPACE="+d.target.Workspace)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = cmd.Start()
+
+	if err != nil {
+		return 0, fmt.Errorf("error running terraform %s: %v", args[0], err)
+	}
+
+	diagnostics := d.logEvents(stdout)
+
+	err = cmd.Wait()
+
+	if err == nil {
+		return 0, nil
+	}
+
+	var exitErr *exec.ExitError
+
+	if !errors.As(err, &exitErr) {
+		return 0, fmt.Errorf("error running terraform %s: %v", args[0], err)
+	}
+
+	exitCode := exitErr.ExitCode()
+
+	messages := make([]string, 0, len(diagnostics))
+
+	for _, diagnostic := range diagnostics {
+		messages = append(messages, diagnostic.String())
+	}
+
+	if errOutput := strings.TrimSpace(stderr.String()); len(messages) == 0 && errOutput != "" {
+		messages = append(messages, errOutput)
+	}
+
+	if len(messages) == 0 {
+		messages = append(messages, err.Error())
+	}
+
+	return exitCode, fmt.Errorf("terraform %s failed: %s", args[0], strings.Join(messages, "; "))
+}
+
+// logEvents logs each event read from the reader, and returns the error diagnostics.
+// Lines which are not JSON events are logged as they are.
+func (d *Driver) logEvents(reader io.Reader) []*eventDiagnostic {
+	diagnostics := make([]*eventDiagnostic, 0)
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventSize)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		ev := &event{}
+
+		err := json.Unmarshal(line, ev)
+
+		if err != nil {
+			d.logger.Info().Str("resource", d.resourceName).Msg(string(line))
+			continue
+		}
+
+		if ev.Diagnostic != nil && ev.Diagnostic.Severity == "error" {
+			diagnostics = append(diagnostics, ev.Diagnostic)
+		}
+
+		d.logEvent(ev)
+	}
+
+	// drain the reader if the scanner stopped early, so that the command can exit
+	io.Copy(io.Discard, reader)
+
+	return diagnostics
+}
+
+func (d *Driver) logEvent(ev *event) {
+	var logEvent *zerolog.Event
+
+	switch ev.Level {
+	case "error":
+		logEvent = d.logger.Error()
+	case "warn":
+		logEvent = d.logger.Warn()
+	case "debug", "trace":
+		logEvent = d.logger.Debug()
+	default:
+		logEvent = d.logger.Info()
+	}
+
+	logEvent = logEvent.Str("resource", d.resourceName).Str("type", ev.Type)
+
+	switch {
+	case ev.Hook != nil && ev.Hook.Resource != nil:
+		logEvent = logEvent.Str("address", ev.Hook.Resource.Addr).Str("action", ev.Hook.Action)
+	case ev.Change != nil && ev.Change.Resource != nil:
+		logEvent = logEvent.Str("address", ev.Change.Resource.Addr).Str("action", ev.Change.Action)
+	case ev.Diagnostic != nil:
+		logEvent = logEvent.Str("diagnostic", ev.Diagnostic.String())
+
+		if ev.Diagnostic.Address != "" {
+			logEvent = logEvent.Str("address", ev.Diagnostic.Address)
+		}
+	}
+
+	logEvent.Msg(ev.Message)
+}
@@ -0,0 +1,229 @@
+package terraform_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/drivers"
+	"github.com/porter-dev/switchboard/pkg/drivers/terraform"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTerraform is a terraform executable which prints the events in events.json when
+// applying, and fails if fail is set in the working directory. It records the data
+// directory and var file of each apply in data_dirs and var_files.
+const fakeTerraform = `#!/bin/sh
+if [ "$1" = "apply" ]; then
+	echo "$TF_DATA_DIR" >> data_dirs
+	for arg in "$@"; do
+		case "$arg" in
+			-var-file=*) echo "${arg#-var-file=}" >> var_files ;;
+		esac
+	done
+	cat events.json
+	if [ -f fail ]; then
+		exit 1
+	fi
+fi
+`
+
+func newFakeTerraformDriver(t *testing.T, events []map[string]interface{}, fail bool) (drivers.Driver, *bytes.Buffer) {
+	allDrivers, logs, _ := newFakeTerraformDrivers(t, events, fail, "rds")
+
+	return allDrivers[0], logs
+}
+
+// newFakeTerraformDrivers returns a driver for each resource name, which all use the
+// same module directory
+func newFakeTerraformDrivers(
+	t *testing.T,
+	events []map[string]interface{},
+	fail bool,
+	names ...string,
+) ([]drivers.Driver, *bytes.Buffer, string) {
+	binDir := t.TempDir()
+
+	err := ioutil.WriteFile(filepath.Join(binDir, "terraform"), []byte(fakeTerraform), 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	moduleDir := t.TempDir()
+
+	var eventLines []byte
+
+	for _, event := range events {
+		eventBytes, _ := json.Marshal(event)
+		eventLines = append(append(eventLines, eventBytes...), '\n')
+	}
+
+	err = ioutil.WriteFile(filepath.Join(moduleDir, "events.json"), eventLines, 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fail {
+		err = ioutil.WriteFile(filepath.Join(moduleDir, "fail"), nil, 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	lookupTable := make(map[string]drivers.Driver)
+
+	res := make([]drivers.Driver, 0)
+
+	for _, name := range names {
+		driver, err := terraform.NewTerraformDriver(&models.Resource{
+			Name: name,
+			Source: map[string]interface{}{
+				"kind": "local",
+				"path": moduleDir,
+			},
+		}, &drivers.SharedDriverOpts{
+			DriverLookupTable: &lookupTable,
+			Logger:            &logger,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res = append(res, driver)
+	}
+
+	return res, &logs, moduleDir
+}
+
+func readLogs(t *testing.T, logs *bytes.Buffer) []map[string]interface{} {
+	res := make([]map[string]interface{}, 0)
+	decoder := json.NewDecoder(logs)
+
+	for decoder.More() {
+		line := make(map[string]interface{})
+
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+
+		res = append(res, line)
+	}
+
+	return res
+}
+
+func TestApplyLogsEvents(t *testing.T) {
+	driver, logs := newFakeTerraformDriver(t, []map[string]interface{}{
+		{
+			"@level":   "info",
+			"@message": "aws_db_instance.db: Creation complete after 5m [id=db-1]",
+			"type":     "apply_complete",
+			"hook": map[string]interface{}{
+				"resource": map[string]interface{}{"addr": "aws_db_instance.db"},
+				"action":   "create",
+			},
+		},
+		{
+			"@level":   "warn",
+			"@message": "Warning: Deprecated attribute",
+			"type":     "diagnostic",
+			"diagnostic": map[string]interface{}{
+				"severity": "warning",
+				"summary":  "Deprecated attribute",
+				"detail":   "name is deprecated",
+				"address":  "aws_db_instance.db",
+			},
+		},
+	}, false)
+
+	_, err := driver.Apply(context.Background(), &models.Resource{Name: "rds"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{
+			"level":    "info",
+			"resource": "rds",
+			"type":     "apply_complete",
+			"address":  "aws_db_instance.db",
+			"action":   "create",
+			"message":  "aws_db_instance.db: Creation complete after 5m [id=db-1]",
+		},
+		{
+			"level":      "warn",
+			"resource":   "rds",
+			"type":       "diagnostic",
+			"diagnostic": "Deprecated attribute: name is deprecated",
+			"address":    "aws_db_instance.db",
+			"message":    "Warning: Deprecated attribute",
+		},
+	}, readLogs(t, logs))
+}
+
+func TestApplyReturnsDiagnostics(t *testing.T) {
+	driver, _ := newFakeTerraformDriver(t, []map[string]interface{}{
+		{
+			"@level":   "error",
+			"@message": "Error: creating database",
+			"type":     "diagnostic",
+			"diagnostic": map[string]interface{}{
+				"severity": "error",
+				"summary":  "creating database",
+				"detail":   "quota exceeded",
+			},
+		},
+	}, true)
+
+	_, err := driver.Apply(context.Background(), &models.Resource{Name: "rds"})
+
+	assert.EqualError(t, err, "terraform apply failed: creating database: quota exceeded")
+}
+
+func TestResourcesUseSeparateDataDirs(t *testing.T) {
+	allDrivers, _, moduleDir := newFakeTerraformDrivers(t, nil, false, "rds-staging", "rds-production")
+
+	for i, name := range []string{"rds-staging", "rds-production"} {
+		_, err := allDrivers[i].Apply(context.Background(), &models.Resource{Name: name})
+
+		assert.NoError(t, err)
+	}
+
+	dataDirs, err := ioutil.ReadFile(filepath.Join(moduleDir, "data_dirs"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, terraform.GetDataDir(moduleDir, "rds-staging")+"\n"+terraform.GetDataDir(moduleDir, "rds-production")+"\n", string(dataDirs))
+	assert.DirExists(t, terraform.GetDataDir(moduleDir, "rds-staging"))
+}
+
+func TestVarFileIsWrittenToDataDir(t *testing.T) {
+	allDrivers, _, moduleDir := newFakeTerraformDrivers(t, nil, true, "rds")
+
+	_, err := allDrivers[0].Apply(context.Background(), &models.Resource{Name: "rds"})
+
+	assert.Error(t, err)
+
+	varFiles, err := ioutil.ReadFile(filepath.Join(moduleDir, "var_files"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, terraform.GetDataDir(moduleDir, "rds"), filepath.Dir(strings.TrimSpace(string(varFiles))))
+
+	// the var file is removed even though the apply failed
+	entries, err := ioutil.ReadDir(terraform.GetDataDir(moduleDir, "rds"))
+
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -2,10 +2,16 @@ package terraform
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/porter-dev/switchboard/utils/objutils"
 )
 
+// VarMethod is the method used to pass variables to Terraform.
+//
+// Deprecated: variables are always passed through a temporary var file, so the var
+// method is ignored.
 type VarMethod string
 
 const (
@@ -14,11 +20,13 @@ const (
 )
 
 const (
-	SourceKindLocal string = "local"
+	SourceKindLocal  string = "local"
+	SourceKindModule string = "module"
 )
 
 type Source struct {
 	*SourceLocal
+	*SourceModule
 
 	Kind      string
 	VarMethod VarMethod
@@ -27,6 +35,21 @@ type SourceLocal struct {
 	Path string
 }
 
+// SourceModule is a module which is fetched from a git repository or extracted from a
+// local tarball into a working directory
+type SourceModule struct {
+	// Git is the URL of a git repository, and Ref is the branch, tag or commit which is
+	// checked out. If Ref is empty, the default branch is checked out.
+	Git string
+	Ref string
+
+	// Archive is the path to a .tar.gz, .tgz or .tar file containing the module
+	Archive string
+
+	// Subdir is the directory of the module inside the repository or archive
+	Subdir string
+}
+
 func GetSource(genericSource map[string]interface{}) (*Source, error) {
 	res := &Source{}
 	var err error
@@ -59,6 +82,43 @@ func GetSource(genericSource map[string]interface{}) (*Source, error) {
 		if err != nil {
 			return nil, err
 		}
+	case SourceKindModule:
+		res.SourceModule, err = getSourceModule(genericSource)
+
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported source kind %s", res.Kind)
+	}
+
+	return res, nil
+}
+
+func getSourceModule(genericSource map[string]interface{}) (*SourceModule, error) {
+	res := &SourceModule{}
+
+	res.Git, _ = objutils.GetNestedString(genericSource, "git")
+	res.Ref, _ = objutils.GetNestedString(genericSource, "ref")
+	res.Archive, _ = objutils.GetNestedString(genericSource, "archive")
+	res.Subdir, _ = objutils.GetNestedString(genericSource, "subdir")
+
+	if (res.Git == "") == (res.Archive == "") {
+		return nil, fmt.Errorf("exactly one of source parameters \"git\" or \"archive\" must be set when using \"module\" kind")
+	}
+
+	if res.Ref != "" && res.Git == "" {
+		return nil, fmt.Errorf("source parameter \"ref\" can only be set along with \"git\"")
+	}
+
+	if res.Subdir != "" {
+		subdir := filepath.Clean(res.Subdir)
+
+		if filepath.IsAbs(subdir) || subdir == ".." || strings.HasPrefix(subdir, "../") {
+			return nil, fmt.Errorf("source parameter \"subdir\" must be a relative path inside the module")
+		}
+
+		res.Subdir = subdir
 	}
 
 	return res, nil
@@ -0,0 +1,180 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/porter-dev/switchboard/internal/query"
+	"github.com/porter-dev/switchboard/utils/objutils"
+)
+
+// Target configures the backend which stores the Terraform state, and the workspace that
+// the module is applied in
+type Target struct {
+	// BackendConfig is a set of backend configuration values, which are written to a
+	// temporary file that is passed to terraform init as -backend-config
+	BackendConfig map[string]string
+
+	// Workspace is the workspace which is selected before the module is applied. It is
+	// created if it does not exist. If it is empty, the current workspace is used.
+	Workspace string
+
+	// Reconfigure ignores any existing backend configuration when initializing, without
+	// migrating state
+	Reconfigure bool
+
+	// MigrateState migrates existing state to the backend if the backend configuration
+	// has changed
+	MigrateState bool
+}
+
+func GetTarget(genericTarget map[string]interface{}) (*Target, error) {
+	res := &Target{
+		BackendConfig: make(map[string]string),
+	}
+
+	if genericTarget == nil {
+		return res, nil
+	}
+
+	if rawBackendConfig, ok := genericTarget["backend_config"]; ok && rawBackendConfig != nil {
+		backendConfig, ok := rawBackendConfig.(map[string]interface{})
+
+		if !ok {
+			return nil, fmt.Errorf("target parameter \"backend_config\" must be a map")
+		}
+
+		for key, val := range backendConfig {
+			switch val.(type) {
+			case string, bool, int, int64, float64:
+				res.BackendConfig[key] = fmt.Sprintf("%v", val)
+			default:
+				return nil, fmt.Errorf("target parameter \"backend_config.%s\" must be a string, number or boolean", key)
+			}
+		}
+	}
+
+	workspace, err := objutils.GetNestedString(genericTarget, "workspace")
+
+	if _, ok := err.(*objutils.NestedFieldNotFoundError); err != nil && !ok {
+		return nil, fmt.Errorf("target parameter \"workspace\" must be a string")
+	}
+
+	res.Workspace = workspace
+
+	res.Reconfigure, err = objutils.GetNestedBool(genericTarget, "reconfigure")
+
+	if _, ok := err.(*objutils.NestedFieldNotFoundError); err != nil && !ok {
+		return nil, fmt.Errorf("target parameter \"reconfigure\" must be a boolean")
+	}
+
+	res.MigrateState, err = objutils.GetNestedBool(genericTarget, "migrate_state")
+
+	if _, ok := err.(*objutils.NestedFieldNotFoundError); err != nil && !ok {
+		return nil, fmt.Errorf("target parameter \"migrate_state\" must be a boolean")
+	}
+
+	if res.Reconfigure && res.MigrateState {
+		return nil, fmt.Errorf("target parameters \"reconfigure\" and \"migrate_state\" cannot both be set")
+	}
+
+	return res, nil
+}
+
+// getInitArgs returns the arguments passed to terraform init. The backend configuration
+// is read from backendConfigFile, rather than passed as arguments, since it commonly
+// contains credentials.
+func (t *Target) getInitArgs(backendConfigFile string) []string {
+	res := []string{"init", "-no-color", "-input=false", "-upgrade"}
+
+	if backendConfigFile != "" {
+		res = append(res, fmt.Sprintf("-backend-config=%s", backendConfigFile))
+	}
+
+	if t.Reconfigure {
+		res = append(res, "-reconfigure")
+	} else if t.MigrateState {
+		// -force-copy answers yes to the prompt to copy state to the new backend
+		res = append(res, "-migrate-state", "-force-copy")
+	}
+
+	return res
+}
+
+// writeBackendConfigFile writes the backend configuration to a temporary file, which
+// only the current user can read. Terraform parses files with a .json suffix as JSON.
+// The returned function removes the file. If there is no backend configuration, no file
+// is written and the path is empty.
+func (t *Target) writeBackendConfigFile() (string, func(), error) {
+	if len(t.BackendConfig) == 0 {
+		return "", func() {}, nil
+	}
+
+	fileBytes, err := json.Marshal(t.BackendConfig)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	// ioutil.TempFile creates the file with 0600 permissions
+	file, err := ioutil.TempFile("", "switchboard-*.tfbackend.json")
+
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating backend config file: %v", err)
+	}
+
+	cleanup := func() {
+		os.Remove(file.Name())
+	}
+
+	_, err = file.Write(fileBytes)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("error writing backend config file: %v", err)
+	}
+
+	return file.Name(), cleanup, nil
+}
+
+// redactBackendConfig replaces the backend configuration values in text with a
+// placeholder, since Terraform may echo them in its errors. Booleans and numbers are
+// kept, since they are not credentials and would otherwise make errors unreadable.
+func (t *Target) redactBackendConfig(text string) string {
+	values := make([]string, 0)
+
+	for _, val := range t.BackendConfig {
+		if val == "" {
+			continue
+		} else if _, err := strconv.ParseBool(val); err == nil {
+			continue
+		} else if _, err := strconv.ParseFloat(val, 64); err == nil {
+			continue
+		}
+
+		values = append(values, val)
+	}
+
+	// longer values are replaced first, so that values containing other values are
+	// fully redacted
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+
+	oldnew := make([]string, 0, 2*len(values))
+
+	for _, val := range values {
+		oldnew = append(oldnew, val, query.Redacted)
+	}
+
+	return strings.NewReplacer(oldnew...).Replace(text)
+}
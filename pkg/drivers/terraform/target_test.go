@@ -0,0 +1,46 @@
+package terraform_test
+
+import (
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/drivers/terraform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTarget(t *testing.T) {
+	target, err := terraform.GetTarget(map[string]interface{}{
+		"backend_config": map[string]interface{}{
+			"bucket":  "tf-state",
+			"encrypt": true,
+		},
+		"workspace":     "staging",
+		"migrate_state": true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &terraform.Target{
+		BackendConfig: map[string]string{
+			"bucket":  "tf-state",
+			"encrypt": "true",
+		},
+		Workspace:    "staging",
+		MigrateState: true,
+	}, target)
+}
+
+func TestGetTargetInvalid(t *testing.T) {
+	_, err := terraform.GetTarget(map[string]interface{}{
+		"reconfigure":   true,
+		"migrate_state": true,
+	})
+
+	assert.EqualError(t, err, "target parameters \"reconfigure\" and \"migrate_state\" cannot both be set")
+
+	_, err = terraform.GetTarget(map[string]interface{}{
+		"backend_config": map[string]interface{}{
+			"bucket": []interface{}{"a", "b"},
+		},
+	})
+
+	assert.EqualError(t, err, "target parameter \"backend_config.bucket\" must be a string, number or boolean")
+}
@@ -0,0 +1,362 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/ext/typeexpr"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Variable is a variable declared by a Terraform module
+type Variable struct {
+	Name string
+
+	// Type is the type constraint of the variable. If the variable does not declare a
+	// type, or the type cannot be parsed, any value is accepted.
+	Type cty.Type
+
+	// Required is true if the variable does not declare a default
+	Required bool
+
+	// Sensitive is true if the variable is declared as sensitive
+	Sensitive bool
+}
+
+var variableSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "variable", LabelNames: []string{"name"}},
+	},
+}
+
+var terraformSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "terraform"},
+	},
+}
+
+var terraformBlockSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "backend", LabelNames: []string{"type"}},
+		{Type: "cloud"},
+	},
+}
+
+var variableBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "type"},
+		{Name: "default"},
+		{Name: "sensitive"},
+	},
+}
+
+// ReadVariables reads the variables declared by the .tf and .tf.json files in a module
+// directory. Files in subdirectories are not read, since they belong to other modules.
+func ReadVariables(dir string) (map[string]*Variable, error) {
+	res := make(map[string]*Variable)
+
+	err := readModuleFiles(dir, func(name string, body hcl.Body) error {
+		content, _, diags := body.PartialContent(variableSchema)
+
+		if diags.HasErrors() {
+			return fmt.Errorf("error parsing %s: %s", name, diags.Error())
+		}
+
+		for _, block := range content.Blocks {
+			variable, err := getVariable(block)
+
+			if err != nil {
+				return fmt.Errorf("error parsing %s: %v", name, err)
+			}
+
+			res[variable.Name] = variable
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ReadBackend returns the type of the backend declared by the terraform block of a
+// module, "cloud" if the module declares a cloud block, or an empty string if it
+// declares neither, in which case Terraform uses the local backend
+func ReadBackend(dir string) (string, error) {
+	res := ""
+
+	err := readModuleFiles(dir, func(name string, body hcl.Body) error {
+		content, _, diags := body.PartialContent(terraformSchema)
+
+		if diags.HasErrors() {
+			return fmt.Errorf("error parsing %s: %s", name, diags.Error())
+		}
+
+		for _, block := range content.Blocks {
+			blockContent, _, diags := block.Body.PartialContent(terraformBlockSchema)
+
+			if diags.HasErrors() {
+				return fmt.Errorf("error parsing %s: %s", name, diags.Error())
+			}
+
+			for _, nestedBlock := range blockContent.Blocks {
+				if nestedBlock.Type == "cloud" {
+					res = "cloud"
+				} else {
+					res = nestedBlock.Labels[0]
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return res, nil
+}
+
+// readModuleFiles parses each .tf and .tf.json file in a module directory, and calls
+// readFile with the name and body of each file
+func readModuleFiles(dir string, readFile func(name string, body hcl.Body) error) error {
+	entries, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		return fmt.Errorf("error reading module directory: %v", err)
+	}
+
+	parser := hclparse.NewParser()
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		var file *hcl.File
+		var diags hcl.Diagnostics
+
+		switch {
+		case strings.HasSuffix(entry.Name(), ".tf"):
+			file, diags = parser.ParseHCLFile(path)
+		case strings.HasSuffix(entry.Name(), ".tf.json"):
+			file, diags = parser.ParseJSONFile(path)
+		default:
+			continue
+		}
+
+		if diags.HasErrors() {
+			return fmt.Errorf("error parsing %s: %s", entry.Name(), diags.Error())
+		}
+
+		err = readFile(entry.Name(), file.Body)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getVariable(block *hcl.Block) (*Variable, error) {
+	res := &Variable{
+		Name:     block.Labels[0],
+		Type:     cty.DynamicPseudoType,
+		Required: true,
+	}
+
+	content, _, diags := block.Body.PartialContent(variableBlockSchema)
+
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("variable %s: %s", res.Name, diags.Error())
+	}
+
+	if attr, ok := content.Attributes["type"]; ok {
+		// newer type constraints, like optional object attributes, cannot be parsed,
+		// so the variable accepts any value and Terraform validates it instead
+		if varType, diags := typeexpr.TypeConstraint(attr.Expr); !diags.HasErrors() {
+			res.Type = varType
+		}
+	}
+
+	if _, ok := content.Attributes["default"]; ok {
+		res.Required = false
+	}
+
+	if attr, ok := content.Attributes["sensitive"]; ok {
+		val, diags := attr.Expr.Value(nil)
+
+		if !diags.HasErrors() && val.Type() == cty.Bool && val.IsKnown() && !val.IsNull() {
+			res.Sensitive = val.True()
+		}
+	}
+
+	return res, nil
+}
+
+// ValidateConfig checks the config against the module's variable declarations. Every
+// key of the config must be a declared variable, every required variable must be set,
+// and every value must be convertible to the variable's type. Required variables which
+// are set through TF_VAR_ environment variables, or through tfvars files which
+// Terraform loads automatically, are not required in the config.
+func ValidateConfig(variables map[string]*Variable, config map[string]interface{}, moduleDir string) error {
+	errors := make([]string, 0)
+
+	keys := make([]string, 0, len(config))
+
+	for key := range config {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		variable, ok := variables[key]
+
+		if !ok {
+			errors = append(errors, fmt.Sprintf("variable %s is not declared by the module", key))
+			continue
+		}
+
+		err := checkType(variable, config[key])
+
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	autoVars, err := readAutoVars(moduleDir)
+
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(variables))
+
+	for name := range variables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !variables[name].Required {
+			continue
+		}
+
+		if _, ok := config[name]; ok {
+			continue
+		} else if _, ok := os.LookupEnv("TF_VAR_" + name); ok {
+			continue
+		} else if autoVars[name] {
+			continue
+		}
+
+		errors = append(errors, fmt.Sprintf("required variable %s is not set", name))
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errors, "; "))
+	}
+
+	return nil
+}
+
+// checkType returns an error if the value cannot be converted to the variable's type
+func checkType(variable *Variable, val interface{}) error {
+	if variable.Type == cty.DynamicPseudoType {
+		return nil
+	}
+
+	valBytes, err := json.Marshal(val)
+
+	if err != nil {
+		return fmt.Errorf("variable %s: %v", variable.Name, err)
+	}
+
+	impliedType, err := ctyjson.ImpliedType(valBytes)
+
+	if err != nil {
+		return fmt.Errorf("variable %s: %v", variable.Name, err)
+	}
+
+	ctyVal, err := ctyjson.Unmarshal(valBytes, impliedType)
+
+	if err != nil {
+		return fmt.Errorf("variable %s: %v", variable.Name, err)
+	}
+
+	_, err = convert.Convert(ctyVal, variable.Type)
+
+	if err != nil {
+		return fmt.Errorf("variable %s must be %s: %v", variable.Name, typeexpr.TypeString(variable.Type), err)
+	}
+
+	return nil
+}
+
+// readAutoVars returns the names of the variables set by terraform.tfvars,
+// terraform.tfvars.json and *.auto.tfvars(.json) files in the module directory
+func readAutoVars(dir string) (map[string]bool, error) {
+	entries, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading module directory: %v", err)
+	}
+
+	parser := hclparse.NewParser()
+	res := make(map[string]bool)
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() {
+			continue
+		}
+
+		var file *hcl.File
+		var diags hcl.Diagnostics
+
+		switch {
+		case name == "terraform.tfvars" || strings.HasSuffix(name, ".auto.tfvars"):
+			file, diags = parser.ParseHCLFile(filepath.Join(dir, name))
+		case name == "terraform.tfvars.json" || strings.HasSuffix(name, ".auto.tfvars.json"):
+			file, diags = parser.ParseJSONFile(filepath.Join(dir, name))
+		default:
+			continue
+		}
+
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("error parsing %s: %s", name, diags.Error())
+		}
+
+		attrs, diags := file.Body.JustAttributes()
+
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("error parsing %s: %s", name, diags.Error())
+		}
+
+		for attrName := range attrs {
+			res[attrName] = true
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,136 @@
+package terraform_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/drivers/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const variablesTF = `
+variable "name" {
+  type = string
+}
+
+variable "replicas" {
+  type    = number
+  default = 1
+}
+
+variable "tags" {
+  type = map(string)
+}
+
+variable "password" {
+  type      = string
+  sensitive = true
+}
+
+variable "anything" {}
+`
+
+const variablesTFJSON = `{
+  "variable": {
+    "region": {
+      "type": "string",
+      "default": "us-east-1"
+    }
+  }
+}`
+
+func writeModule(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestReadVariables(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"variables.tf":      variablesTF,
+		"variables.tf.json": variablesTFJSON,
+	})
+
+	variables, err := terraform.ReadVariables(dir)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*terraform.Variable{
+		"name":     {Name: "name", Type: cty.String, Required: true},
+		"replicas": {Name: "replicas", Type: cty.Number},
+		"tags":     {Name: "tags", Type: cty.Map(cty.String), Required: true},
+		"password": {Name: "password", Type: cty.String, Required: true, Sensitive: true},
+		"anything": {Name: "anything", Type: cty.DynamicPseudoType, Required: true},
+		"region":   {Name: "region", Type: cty.String},
+	}, variables)
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"variables.tf":     variablesTF,
+		"terraform.tfvars": `password = "secret"`,
+	})
+
+	variables, err := terraform.ReadVariables(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = terraform.ValidateConfig(variables, map[string]interface{}{
+		"name":     "db",
+		"replicas": "3",
+		"tags":     map[string]interface{}{"team": "data"},
+		"anything": []interface{}{1, "a"},
+	}, dir)
+
+	assert.NoError(t, err)
+
+	t.Setenv("TF_VAR_tags", `{}`)
+
+	err = terraform.ValidateConfig(variables, map[string]interface{}{
+		"replicas": []interface{}{1},
+		"region":   "us-east-1",
+	}, dir)
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "variable region is not declared by the module")
+		assert.Contains(t, err.Error(), "variable replicas must be number")
+		assert.Contains(t, err.Error(), "required variable name is not set")
+		assert.NotContains(t, err.Error(), "required variable tags is not set")
+		assert.NotContains(t, err.Error(), "required variable password is not set")
+	}
+}
+
+func TestReadBackend(t *testing.T) {
+	for _, test := range []struct {
+		files   map[string]string
+		backend string
+	}{
+		{map[string]string{"main.tf": variablesTF}, ""},
+		{map[string]string{"main.tf": `terraform {
+  required_version = ">= 1.0"
+  backend "s3" {}
+}`}, "s3"},
+		{map[string]string{"main.tf.json": `{"terraform": {"backend": {"local": {}}}}`}, "local"},
+		{map[string]string{"main.tf": `terraform {
+  cloud {
+    organization = "my-org"
+  }
+}`}, "cloud"},
+	} {
+		backend, err := terraform.ReadBackend(writeModule(t, test.files))
+
+		assert.NoError(t, err)
+		assert.Equal(t, test.backend, backend)
+	}
+}
@@ -0,0 +1,187 @@
+package encryption
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Decrypter decrypts values which were encrypted for one of its age identities.
+// A nil Decrypter can be used to read files which contain no encrypted values.
+type Decrypter struct {
+	identities []age.Identity
+}
+
+// NewDecrypter returns a Decrypter which decrypts with the given identities
+func NewDecrypter(identities ...age.Identity) *Decrypter {
+	return &Decrypter{identities}
+}
+
+// LoadKeyFile returns a Decrypter which decrypts with the identities in an age key file,
+// in the format written by age-keygen.
+func LoadKeyFile(path string) (*Decrypter, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading age key file: %v", err)
+	}
+
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing age key file %s: %v", path, err)
+	}
+
+	return NewDecrypter(identities...), nil
+}
+
+// IsEncryptedValue returns true if val is an armored age ciphertext
+func IsEncryptedValue(val string) bool {
+	return strings.HasPrefix(strings.TrimSpace(val), armor.Header)
+}
+
+// EncryptValue encrypts val for the recipients, and returns an armored ciphertext which
+// can be used as an inline encrypted value.
+func EncryptValue(val string, recipients ...age.Recipient) (string, error) {
+	buf := &bytes.Buffer{}
+	armorWriter := armor.NewWriter(buf)
+
+	writer, err := age.Encrypt(armorWriter, recipients...)
+
+	if err != nil {
+		return "", fmt.Errorf("error encrypting value: %v", err)
+	}
+
+	if _, err := writer.Write([]byte(val)); err != nil {
+		return "", fmt.Errorf("error encrypting value: %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("error encrypting value: %v", err)
+	}
+
+	if err := armorWriter.Close(); err != nil {
+		return "", fmt.Errorf("error encrypting value: %v", err)
+	}
+
+	return buf.String(), nil
+}
+
+// DecryptValue decrypts an armored age ciphertext
+func (d *Decrypter) DecryptValue(val string) (string, error) {
+	res, err := d.decrypt(strings.TrimSpace(val))
+
+	if err != nil {
+		return "", fmt.Errorf("error decrypting value: %v", err)
+	}
+
+	return string(res), nil
+}
+
+// DecryptValues returns a copy of val in which every inline encrypted value is decrypted,
+// along with a mask which marks the decrypted values.
+func (d *Decrypter) DecryptValues(val map[string]interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	res, mask, err := d.decryptValues(val, "")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resMap, _ := res.(map[string]interface{})
+	maskMap, _ := mask.(map[string]interface{})
+
+	return resMap, maskMap, nil
+}
+
+func (d *Decrypter) decryptValues(val interface{}, path string) (interface{}, interface{}, error) {
+	switch typedVal := val.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(typedVal))
+		mask := make(map[string]interface{})
+
+		for key, nestedVal := range typedVal {
+			nestedRes, nestedMask, err := d.decryptValues(nestedVal, joinPath(path, key))
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			res[key] = nestedRes
+
+			if nestedMask != nil {
+				mask[key] = nestedMask
+			}
+		}
+
+		if len(mask) == 0 {
+			return res, nil, nil
+		}
+
+		return res, mask, nil
+	case []interface{}:
+		res := make([]interface{}, len(typedVal))
+		mask := make([]interface{}, len(typedVal))
+		isMasked := false
+
+		for i, nestedVal := range typedVal {
+			nestedRes, nestedMask, err := d.decryptValues(nestedVal, fmt.Sprintf("%s[%d]", path, i))
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			res[i] = nestedRes
+			mask[i] = nestedMask
+			isMasked = isMasked || nestedMask != nil
+		}
+
+		if !isMasked {
+			return res, nil, nil
+		}
+
+		return res, mask, nil
+	case string:
+		if !IsEncryptedValue(typedVal) {
+			return typedVal, nil, nil
+		}
+
+		res, err := d.DecryptValue(typedVal)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		return res, true, nil
+	}
+
+	return val, nil, nil
+}
+
+func (d *Decrypter) decrypt(armored string) ([]byte, error) {
+	if d == nil || len(d.identities) == 0 {
+		return nil, fmt.Errorf("value is encrypted, but no age key file was set")
+	}
+
+	reader, err := age.Decrypt(armor.NewReader(strings.NewReader(armored)), d.identities...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(reader)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
@@ -0,0 +1,94 @@
+package encryption_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/porter-dev/switchboard/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestIdentity(t *testing.T) *age.X25519Identity {
+	identity, err := age.GenerateX25519Identity()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return identity
+}
+
+func encryptValue(t *testing.T, val string, identity *age.X25519Identity) string {
+	res, err := encryption.EncryptValue(val, identity.Recipient())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	identity := getTestIdentity(t)
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+
+	err := ioutil.WriteFile(keyFile, []byte("# public key: "+identity.Recipient().String()+"\n"+identity.String()+"\n"), 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypter, err := encryption.LoadKeyFile(keyFile)
+
+	assert.NoError(t, err)
+
+	res, err := decrypter.DecryptValue(encryptValue(t, "hunter2", identity))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", res)
+}
+
+func TestDecryptValues(t *testing.T) {
+	identity := getTestIdentity(t)
+	decrypter := encryption.NewDecrypter(identity)
+
+	res, mask, err := decrypter.DecryptValues(map[string]interface{}{
+		"password": encryptValue(t, "hunter2", identity),
+		"keys":     []interface{}{"public", encryptValue(t, "private", identity)},
+		"host":     "db.internal",
+		"port":     5432,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"password": "hunter2",
+		"keys":     []interface{}{"public", "private"},
+		"host":     "db.internal",
+		"port":     5432,
+	}, res)
+	assert.Equal(t, map[string]interface{}{
+		"password": true,
+		"keys":     []interface{}{nil, true},
+	}, mask)
+}
+
+func TestDecryptValuesErrors(t *testing.T) {
+	identity := getTestIdentity(t)
+	val := map[string]interface{}{
+		"config": map[string]interface{}{"password": encryptValue(t, "hunter2", identity)},
+	}
+
+	var decrypter *encryption.Decrypter
+
+	_, _, err := decrypter.DecryptValues(val)
+
+	assert.EqualError(t, err, "config.password: error decrypting value: value is encrypted, but no age key file was set")
+
+	_, _, err = encryption.NewDecrypter(getTestIdentity(t)).DecryptValues(val)
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "config.password: error decrypting value: no identity matched any of the recipients")
+	}
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type ResourceGroup struct {
 	APIVersion string
 	Resources  []*Resource
@@ -12,4 +14,66 @@ type Resource struct {
 	Source       map[string]interface{}
 	Target       map[string]interface{}
 	Dependencies []string
+
+	// DeclaredConfig is the config as it was declared, before secret references were
+	// resolved, with decrypted values redacted. It is recorded in the state instead of
+	// Config, so that resolved secrets are never stored.
+	DeclaredConfig map[string]interface{}
+
+	// DeclaredSource and DeclaredTarget are the source and target with decrypted values
+	// redacted. They are recorded in the state instead of Source and Target.
+	DeclaredSource map[string]interface{}
+	DeclaredTarget map[string]interface{}
+
+	// DecryptedHash is a hash of the values which were decrypted when the resource group
+	// was parsed, or empty if no values were decrypted. It is recorded in the state, so
+	// that the redacted values can be checked when the resource is rolled back.
+	DecryptedHash string
+
+	// SavedOutput is the output recorded in the state when the resource was last applied,
+	// with sensitive values redacted. It is only set when a resource is pruned, since its
+	// config is no longer declared, so that drivers can identify what to delete.
+	SavedOutput map[string]interface{}
+
+	// ConfigMask marks the values in Config which are sensitive, like resolved secrets.
+	// These values are not parsed as queries when the config is constructed.
+	ConfigMask map[string]interface{}
+
+	// Timeout is the maximum duration of an operation on the resource. If it is
+	// zero, operations do not time out.
+	Timeout time.Duration
+
+	// Wait determines when the resource is ready after it has been applied. If it
+	// is nil, the resource is ready as soon as it is applied.
+	Wait *Wait
+}
+
+// Wait describes the checks which must pass before an applied resource is ready
+type Wait struct {
+	// Conditions must be set in the status of the resource's objects
+	Conditions []*WaitCondition
+
+	// Rollout waits for deployments, stateful sets and daemon sets to finish rolling out
+	Rollout bool
+
+	// Jobs waits for jobs to complete
+	Jobs bool
+
+	// JSONPath is a query against the resource's objects which must return a result.
+	// If Value is set, the result must also be equal to Value.
+	JSONPath string
+	Value    string
+
+	// Timeout is the maximum duration to wait for
+	Timeout time.Duration
+}
+
+// WaitCondition is a status condition which must be set on an object
+type WaitCondition struct {
+	// Kind restricts the condition to objects of this kind. If it is empty, the
+	// condition must be set on every object.
+	Kind string
+
+	Type   string
+	Status string
 }
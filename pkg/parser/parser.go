@@ -1,6 +1,10 @@
 package parser
 
 import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/porter-dev/switchboard/pkg/encryption"
 	"github.com/porter-dev/switchboard/pkg/types"
 	"sigs.k8s.io/yaml"
 )
@@ -16,3 +20,58 @@ func ParseRawBytes(raw []byte) (*types.ResourceGroup, error) {
 
 	return res, nil
 }
+
+// ParseEncryptedBytes parses a resource group which may contain inline age-encrypted
+// values, which are decrypted in memory. Decrypted values in the source, target and
+// config of a resource are marked in its SourceMask, TargetMask and ConfigMask. The
+// decrypter may be nil if the file contains no encrypted values.
+func ParseEncryptedBytes(raw []byte, decrypter *encryption.Decrypter) (*types.ResourceGroup, error) {
+	doc := make(map[string]interface{})
+
+	err := yaml.Unmarshal(raw, &doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc, mask, err := decrypter.DecryptValues(doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	docBytes, err := json.Marshal(doc)
+
+	if err != nil {
+		return nil, fmt.Errorf("error encoding decrypted resource group: %v", err)
+	}
+
+	res, err := ParseRawBytes(docBytes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, resource := range res.Resources {
+		resource.SourceMask = getResourceMask(mask, i, "source")
+		resource.TargetMask = getResourceMask(mask, i, "target")
+		resource.ConfigMask = getResourceMask(mask, i, "config")
+	}
+
+	return res, nil
+}
+
+// getResourceMask returns the part of a resource group's mask which marks the section at
+// key, like the config, of the resource at index i
+func getResourceMask(mask map[string]interface{}, i int, key string) map[string]interface{} {
+	resourcesMask, _ := mask["resources"].([]interface{})
+
+	if i >= len(resourcesMask) {
+		return nil
+	}
+
+	resourceMask, _ := resourcesMask[i].(map[string]interface{})
+	sectionMask, _ := resourceMask[key].(map[string]interface{})
+
+	return sectionMask
+}
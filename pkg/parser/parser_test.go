@@ -0,0 +1,69 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/porter-dev/switchboard/pkg/encryption"
+	"github.com/porter-dev/switchboard/pkg/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEncryptedBytes(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	password, err := encryption.EncryptValue("hunter2", identity.Recipient())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	context, err := encryption.EncryptValue("production", identity.Recipient())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := `version: v1
+resources:
+- name: rds
+  driver: terraform
+  target:
+    kubeconfig_context: |
+` + indent(context, "      ") + `
+  config:
+    rds_username: admin
+    rds_password: |
+` + indent(password, "      ") + `
+- name: web
+  driver: helm
+  config:
+    replicas: 2
+`
+
+	group, err := parser.ParseEncryptedBytes([]byte(raw), encryption.NewDecrypter(identity))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "production", group.Resources[0].Target["kubeconfig_context"])
+	assert.Equal(t, map[string]interface{}{
+		"rds_username": "admin",
+		"rds_password": "hunter2",
+	}, group.Resources[0].Config)
+	assert.Equal(t, map[string]interface{}{"kubeconfig_context": true}, group.Resources[0].TargetMask)
+	assert.Equal(t, map[string]interface{}{"rds_password": true}, group.Resources[0].ConfigMask)
+	assert.Nil(t, group.Resources[0].SourceMask)
+	assert.Nil(t, group.Resources[1].ConfigMask)
+
+	_, err = parser.ParseEncryptedBytes([]byte(raw), nil)
+
+	assert.Error(t, err)
+}
+
+func indent(text, prefix string) string {
+	return prefix + strings.ReplaceAll(strings.TrimSpace(text), "\n", "\n"+prefix)
+}
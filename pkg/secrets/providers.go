@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/porter-dev/switchboard/pkg/drivers/kubernetes"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// EnvProvider resolves secrets from environment variables. The reference is the name of
+// the variable, which must be set.
+type EnvProvider struct{}
+
+func (p *EnvProvider) GetSecret(ctx context.Context, ref string) (string, error) {
+	val, ok := os.LookupEnv(ref)
+
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+
+	return val, nil
+}
+
+// FileProvider resolves secrets from files. The reference is the path to the file, and
+// relative paths are resolved relative to BaseDir. A single trailing newline is removed
+// from the contents, since most editors add one.
+type FileProvider struct {
+	BaseDir string
+}
+
+func (p *FileProvider) GetSecret(ctx context.Context, ref string) (string, error) {
+	path := ref
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.BaseDir, path)
+	}
+
+	fileBytes, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return "", fmt.Errorf("error reading secret file: %v", err)
+	}
+
+	res := strings.TrimSuffix(string(fileBytes), "\n")
+	res = strings.TrimSuffix(res, "\r")
+
+	return res, nil
+}
+
+// KubernetesProvider resolves secrets from Kubernetes secrets. The reference has the form
+// namespace/name/key. If Client is not set, a client is created from Kubeconfig and
+// Context when the first secret is resolved.
+type KubernetesProvider struct {
+	Client typedcorev1.CoreV1Interface
+
+	Kubeconfig string
+	Context    string
+
+	clientOnce sync.Once
+	clientErr  error
+}
+
+func (p *KubernetesProvider) GetSecret(ctx context.Context, ref string) (string, error) {
+	parts := strings.Split(ref, "/")
+
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("kubernetes secret reference must have the form namespace/name/key")
+	}
+
+	client, err := p.getClient()
+
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := client.Secrets(parts[0]).Get(ctx, parts[1], metav1.GetOptions{})
+
+	if err != nil && errors.IsNotFound(err) {
+		return "", fmt.Errorf("secret %s/%s not found", parts[0], parts[1])
+	} else if err != nil {
+		return "", fmt.Errorf("error reading secret %s/%s: %v", parts[0], parts[1], err)
+	}
+
+	if val, ok := secret.Data[parts[2]]; ok {
+		return string(val), nil
+	} else if val, ok := secret.StringData[parts[2]]; ok {
+		return val, nil
+	}
+
+	return "", fmt.Errorf("key %s not found in secret %s/%s", parts[2], parts[0], parts[1])
+}
+
+func (p *KubernetesProvider) getClient() (typedcorev1.CoreV1Interface, error) {
+	p.clientOnce.Do(func() {
+		if p.Client != nil {
+			return
+		}
+
+		agent, err := kubernetes.GetAgentFromHost(p.Kubeconfig, p.Context, "default")
+
+		if err != nil {
+			p.clientErr = fmt.Errorf("could not get kube client for secrets: %v", err)
+			return
+		}
+
+		p.Client = agent.Clientset.CoreV1()
+	})
+
+	return p.Client, p.clientErr
+}
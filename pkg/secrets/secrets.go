@@ -0,0 +1,164 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// refRegex matches secret references, like { secret:env.DB_PASSWORD }. The first group
+// is the kind of the secret, which selects the provider, and the second group is the
+// reference passed to the provider.
+var refRegex = regexp.MustCompile(`\{\s*secret:([A-Za-z0-9_-]+)\.([^{}]*?)\s*\}`)
+
+// SecretProvider resolves references to secrets of a single kind. The ref is the part
+// of the reference after the kind, like DB_PASSWORD in { secret:env.DB_PASSWORD }.
+type SecretProvider interface {
+	GetSecret(ctx context.Context, ref string) (string, error)
+}
+
+// Resolver replaces secret references in configs with the values returned by the
+// provider registered for each kind of secret
+type Resolver struct {
+	providers map[string]SecretProvider
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		providers: make(map[string]SecretProvider),
+	}
+}
+
+// RegisterProvider registers the provider which resolves secrets of the given kind
+func (r *Resolver) RegisterProvider(kind string, provider SecretProvider) error {
+	if _, ok := r.providers[kind]; ok {
+		return fmt.Errorf("secret provider with kind '%s' already exists", kind)
+	}
+
+	r.providers[kind] = provider
+
+	return nil
+}
+
+// Resolve returns a copy of the config in which every secret reference is replaced by
+// the value of the secret, along with a mask which marks every value containing a secret
+// as sensitive. The mask has the same format as the masks of drivers.SensitiveOutputDriver,
+// and is nil if the config contains no references. References may make up a whole value,
+// or be embedded in a larger string. Every reference which cannot be resolved is
+// returned in the error.
+func (r *Resolver) Resolve(ctx context.Context, config map[string]interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	resolver := &configResolver{r, ctx, make([]string, 0)}
+
+	res, mask := resolver.resolveMap(config)
+
+	if len(resolver.errors) > 0 {
+		sort.Strings(resolver.errors)
+
+		return nil, nil, fmt.Errorf("error resolving secrets: %s", strings.Join(resolver.errors, "; "))
+	}
+
+	if mask == nil {
+		return res, nil, nil
+	}
+
+	return res, mask.(map[string]interface{}), nil
+}
+
+type configResolver struct {
+	*Resolver
+
+	ctx    context.Context
+	errors []string
+}
+
+func (r *configResolver) resolveMap(mapVal map[string]interface{}) (map[string]interface{}, interface{}) {
+	res := make(map[string]interface{})
+	mask := make(map[string]interface{})
+
+	for key, val := range mapVal {
+		var valMask interface{}
+
+		res[key], valMask = r.resolveInterface(val)
+
+		if valMask != nil {
+			mask[key] = valMask
+		}
+	}
+
+	if len(mask) == 0 {
+		return res, nil
+	}
+
+	return res, mask
+}
+
+func (r *configResolver) resolveSlice(arr []interface{}) ([]interface{}, interface{}) {
+	res := make([]interface{}, 0)
+	mask := make([]interface{}, len(arr))
+	isSensitive := false
+
+	for i, arrVal := range arr {
+		val, valMask := r.resolveInterface(arrVal)
+
+		res = append(res, val)
+		mask[i] = valMask
+
+		if valMask != nil {
+			isSensitive = true
+		}
+	}
+
+	if !isSensitive {
+		return res, nil
+	}
+
+	return res, mask
+}
+
+func (r *configResolver) resolveInterface(val interface{}) (interface{}, interface{}) {
+	switch typedVal := val.(type) {
+	case []interface{}:
+		return r.resolveSlice(typedVal)
+	case map[string]interface{}:
+		return r.resolveMap(typedVal)
+	case string:
+		if !refRegex.MatchString(typedVal) {
+			return val, nil
+		}
+
+		res := refRegex.ReplaceAllStringFunc(typedVal, func(ref string) string {
+			matches := refRegex.FindStringSubmatch(ref)
+
+			secret, err := r.getSecret(matches[1], matches[2])
+
+			if err != nil {
+				r.errors = append(r.errors, err.Error())
+				return ref
+			}
+
+			return secret
+		})
+
+		return res, true
+	default:
+		return val, nil
+	}
+}
+
+func (r *configResolver) getSecret(kind, ref string) (string, error) {
+	provider, ok := r.providers[kind]
+
+	if !ok {
+		return "", fmt.Errorf("no secret provider found with kind '%s'", kind)
+	}
+
+	secret, err := provider.GetSecret(r.ctx, ref)
+
+	if err != nil {
+		return "", fmt.Errorf("secret %s.%s: %v", kind, ref, err)
+	}
+
+	return secret, nil
+}
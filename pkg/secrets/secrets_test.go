@@ -0,0 +1,77 @@
+package secrets_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func getTestResolver(t *testing.T) *secrets.Resolver {
+	baseDir := t.TempDir()
+
+	err := ioutil.WriteFile(filepath.Join(baseDir, "api-key"), []byte("file-secret\n"), 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "apps"},
+		Data:       map[string][]byte{"password": []byte("k8s-secret")},
+	})
+
+	resolver := secrets.NewResolver()
+	resolver.RegisterProvider("env", &secrets.EnvProvider{})
+	resolver.RegisterProvider("file", &secrets.FileProvider{BaseDir: baseDir})
+	resolver.RegisterProvider("k8s", &secrets.KubernetesProvider{Client: client.CoreV1()})
+
+	return resolver
+}
+
+func TestResolve(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "env-secret")
+
+	config, mask, err := getTestResolver(t).Resolve(context.Background(), map[string]interface{}{
+		"password": "{ secret:env.DB_PASSWORD }",
+		"url":      "postgres://admin:{ secret:k8s.apps/db/password }@db:5432",
+		"keys":     []interface{}{"public", "{ secret:file.api-key }"},
+		"query":    "{ .rds.host }",
+		"replicas": 2,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"password": "env-secret",
+		"url":      "postgres://admin:k8s-secret@db:5432",
+		"keys":     []interface{}{"public", "file-secret"},
+		"query":    "{ .rds.host }",
+		"replicas": 2,
+	}, config)
+	assert.Equal(t, map[string]interface{}{
+		"password": true,
+		"url":      true,
+		"keys":     []interface{}{nil, true},
+	}, mask)
+}
+
+func TestResolveErrors(t *testing.T) {
+	_, _, err := getTestResolver(t).Resolve(context.Background(), map[string]interface{}{
+		"missing":   "{ secret:env.SWITCHBOARD_UNSET_SECRET }",
+		"unknown":   "{ secret:vault.db/password }",
+		"wrong_key": "{ secret:k8s.apps/db/username }",
+	})
+
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "secret env.SWITCHBOARD_UNSET_SECRET: environment variable SWITCHBOARD_UNSET_SECRET is not set")
+		assert.Contains(t, err.Error(), "no secret provider found with kind 'vault'")
+		assert.Contains(t, err.Error(), "secret k8s.apps/db/username: key username not found in secret apps/db")
+	}
+}
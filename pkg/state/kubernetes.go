@@ -0,0 +1,169 @@
+package state
+
+// State can be stored in a Kubernetes cluster, similarly to Helm storage drivers.
+//
+// This includes:
+// - secret
+// - configmap
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// stateKey is the key in the secret or configmap data that holds the state
+const stateKey = "state"
+
+// NewKubernetesBackend is a function type for returning a new Kubernetes state backend
+type NewKubernetesBackend func(
+	v1Interface typedcorev1.CoreV1Interface,
+	namespace string,
+	name string,
+) Backend
+
+// KubernetesBackendMap is a map from backend names to a function that initializes
+// that Kubernetes state backend.
+var KubernetesBackendMap map[string]NewKubernetesBackend = map[string]NewKubernetesBackend{
+	"secret":    newSecretBackend,
+	"configmap": newConfigMapBackend,
+}
+
+var stateLabels = map[string]string{
+	"owner": "switchboard",
+}
+
+// SecretBackend stores state in a Kubernetes secret
+type SecretBackend struct {
+	client typedcorev1.SecretInterface
+	name   string
+}
+
+func newSecretBackend(
+	v1Interface typedcorev1.CoreV1Interface,
+	namespace string,
+	name string,
+) Backend {
+	return &SecretBackend{
+		client: v1Interface.Secrets(namespace),
+		name:   name,
+	}
+}
+
+func (s *SecretBackend) Load(ctx context.Context) (*State, error) {
+	secret, err := s.client.Get(ctx, s.name, metav1.GetOptions{})
+
+	if err != nil && errors.IsNotFound(err) {
+		return NewState(), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading state secret: %v", err)
+	}
+
+	return decode(secret.Data[stateKey])
+}
+
+func (s *SecretBackend) Save(ctx context.Context, state *State) error {
+	stateBytes, err := encode(state)
+
+	if err != nil {
+		return err
+	}
+
+	secret, err := s.client.Get(ctx, s.name, metav1.GetOptions{})
+
+	if err != nil && errors.IsNotFound(err) {
+		_, err = s.client.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   s.name,
+				Labels: stateLabels,
+			},
+			Data: map[string][]byte{
+				stateKey: stateBytes,
+			},
+		}, metav1.CreateOptions{})
+
+		return err
+	} else if err != nil {
+		return fmt.Errorf("error reading state secret: %v", err)
+	}
+
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+
+	secret.Data[stateKey] = stateBytes
+
+	_, err = s.client.Update(ctx, secret, metav1.UpdateOptions{})
+
+	return err
+}
+
+// ConfigMapBackend stores state in a Kubernetes configmap
+type ConfigMapBackend struct {
+	client typedcorev1.ConfigMapInterface
+	name   string
+}
+
+func newConfigMapBackend(
+	v1Interface typedcorev1.CoreV1Interface,
+	namespace string,
+	name string,
+) Backend {
+	return &ConfigMapBackend{
+		client: v1Interface.ConfigMaps(namespace),
+		name:   name,
+	}
+}
+
+func (c *ConfigMapBackend) Load(ctx context.Context) (*State, error) {
+	configMap, err := c.client.Get(ctx, c.name, metav1.GetOptions{})
+
+	if err != nil && errors.IsNotFound(err) {
+		return NewState(), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading state configmap: %v", err)
+	}
+
+	return decode([]byte(configMap.Data[stateKey]))
+}
+
+func (c *ConfigMapBackend) Save(ctx context.Context, state *State) error {
+	stateBytes, err := encode(state)
+
+	if err != nil {
+		return err
+	}
+
+	configMap, err := c.client.Get(ctx, c.name, metav1.GetOptions{})
+
+	if err != nil && errors.IsNotFound(err) {
+		_, err = c.client.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   c.name,
+				Labels: stateLabels,
+			},
+			Data: map[string]string{
+				stateKey: string(stateBytes),
+			},
+		}, metav1.CreateOptions{})
+
+		return err
+	} else if err != nil {
+		return fmt.Errorf("error reading state configmap: %v", err)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+
+	configMap.Data[stateKey] = string(stateBytes)
+
+	_, err = c.client.Update(ctx, configMap, metav1.UpdateOptions{})
+
+	return err
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LocalBackend stores state as a JSON file on the local filesystem
+type LocalBackend struct {
+	Path string
+}
+
+// NewLocalBackend returns a backend which stores state in the file at path
+func NewLocalBackend(path string) *LocalBackend {
+	return &LocalBackend{path}
+}
+
+func (l *LocalBackend) Load(ctx context.Context) (*State, error) {
+	fileBytes, err := ioutil.ReadFile(l.Path)
+
+	if err != nil && os.IsNotExist(err) {
+		return NewState(), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading state file: %v", err)
+	}
+
+	res, err := decode(fileBytes)
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing state file: %v", err)
+	}
+
+	return res, nil
+}
+
+func (l *LocalBackend) Save(ctx context.Context, state *State) error {
+	stateBytes, err := encode(state)
+
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(l.Path); dir != "" {
+		err = os.MkdirAll(dir, 0700)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// write to a temporary file first, so that a failed write does not corrupt
+	// the existing state
+	tmpPath := l.Path + ".tmp"
+
+	err = ioutil.WriteFile(tmpPath, stateBytes, 0600)
+
+	if err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+
+	return os.Rename(tmpPath, l.Path)
+}
@@ -0,0 +1,102 @@
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// StateVersion is the current version of the state format
+const StateVersion = 1
+
+// State records the resources that were applied by the worker, so that subsequent
+// runs can compare against them.
+type State struct {
+	Version   int                       `json:"version"`
+	Resources map[string]*ResourceState `json:"resources"`
+}
+
+// ResourceState is the recorded state of a single resource after a successful apply.
+type ResourceState struct {
+	Name         string                 `json:"name"`
+	Driver       string                 `json:"driver"`
+	Source       map[string]interface{} `json:"source"`
+	Target       map[string]interface{} `json:"target"`
+	Config       map[string]interface{} `json:"config"`
+	Dependencies []string               `json:"depends_on"`
+
+	// ConfigHash is a hash of the rendered config, after queries were populated
+	ConfigHash string `json:"config_hash"`
+
+	// DecryptedHash is a hash of the values which were decrypted from an encrypted
+	// resource group. These values are redacted from the source, target and config.
+	DecryptedHash string `json:"decrypted_hash,omitempty"`
+
+	// Output is the output of the driver after the resource was applied, with sensitive
+	// values redacted
+	Output map[string]interface{} `json:"output"`
+
+	// OutputMask marks the values which were redacted from the output
+	OutputMask map[string]interface{} `json:"output_mask,omitempty"`
+
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// Backend is a storage mechanism for state
+type Backend interface {
+	// Load reads the state from the backend. If no state has been saved, an
+	// empty state is returned.
+	Load(ctx context.Context) (*State, error)
+
+	// Save writes the state to the backend
+	Save(ctx context.Context, state *State) error
+}
+
+// NewState returns an empty state
+func NewState() *State {
+	return &State{
+		Version:   StateVersion,
+		Resources: make(map[string]*ResourceState),
+	}
+}
+
+// HashConfig returns a sha256 hash of a rendered config. Map keys are sorted
+// when marshaled, so equal configs always have equal hashes.
+func HashConfig(config map[string]interface{}) (string, error) {
+	configBytes, err := json.Marshal(config)
+
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(configBytes)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// decode parses raw state bytes, returning an empty state if the bytes are empty
+func decode(raw []byte) (*State, error) {
+	res := NewState()
+
+	if len(raw) == 0 {
+		return res, nil
+	}
+
+	err := json.Unmarshal(raw, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Resources == nil {
+		res.Resources = make(map[string]*ResourceState)
+	}
+
+	return res, nil
+}
+
+func encode(state *State) ([]byte, error) {
+	return json.MarshalIndent(state, "", "  ")
+}
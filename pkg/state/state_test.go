@@ -0,0 +1,91 @@
+package state_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/state"
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func getTestState() *state.State {
+	st := state.NewState()
+
+	st.Resources["rds"] = &state.ResourceState{
+		Name:   "rds",
+		Driver: "terraform",
+		Config: map[string]interface{}{
+			"rds_username": "general",
+		},
+		ConfigHash: "hash",
+		Output: map[string]interface{}{
+			"rds_host": "deathstar",
+		},
+	}
+
+	return st
+}
+
+func TestLocalBackend(t *testing.T) {
+	backend := state.NewLocalBackend(filepath.Join(t.TempDir(), "nested", "state.json"))
+
+	st, err := backend.Load(context.Background())
+
+	assert.NoError(t, err, "loading missing state file should not throw error")
+	assert.Empty(t, st.Resources, "missing state file should return empty state")
+
+	err = backend.Save(context.Background(), getTestState())
+
+	assert.NoError(t, err, "saving state should not throw error")
+
+	st, err = backend.Load(context.Background())
+
+	assert.NoError(t, err, "loading state should not throw error")
+	assert.Equal(t, "deathstar", st.Resources["rds"].Output["rds_host"], "output is persisted")
+	assert.Equal(t, "terraform", st.Resources["rds"].Driver, "driver is persisted")
+}
+
+func TestKubernetesBackends(t *testing.T) {
+	for name, newBackend := range state.KubernetesBackendMap {
+		clientset := fake.NewSimpleClientset()
+		backend := newBackend(clientset.CoreV1(), "default", "switchboard-state")
+
+		st, err := backend.Load(context.Background())
+
+		assert.NoError(t, err, "%s: loading missing state should not throw error", name)
+		assert.Empty(t, st.Resources, "%s: missing state should return empty state", name)
+
+		// save twice to exercise both create and update
+		assert.NoError(t, backend.Save(context.Background(), state.NewState()), "%s: creating state should not throw error", name)
+		assert.NoError(t, backend.Save(context.Background(), getTestState()), "%s: updating state should not throw error", name)
+
+		st, err = backend.Load(context.Background())
+
+		assert.NoError(t, err, "%s: loading state should not throw error", name)
+		assert.Equal(t, "deathstar", st.Resources["rds"].Output["rds_host"], "%s: output is persisted", name)
+	}
+}
+
+func TestHashConfig(t *testing.T) {
+	hash1, err := state.HashConfig(map[string]interface{}{
+		"a": 1,
+		"b": map[string]interface{}{"c": "d", "e": "f"},
+	})
+
+	assert.NoError(t, err, "hashing config should not throw error")
+
+	hash2, _ := state.HashConfig(map[string]interface{}{
+		"b": map[string]interface{}{"e": "f", "c": "d"},
+		"a": 1,
+	})
+
+	hash3, _ := state.HashConfig(map[string]interface{}{
+		"a": 2,
+	})
+
+	assert.Equal(t, hash1, hash2, "equal configs have equal hashes")
+	assert.NotEqual(t, hash1, hash3, "different configs have different hashes")
+}
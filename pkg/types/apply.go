@@ -1,9 +1,39 @@
 package types
 
-import "github.com/rs/zerolog"
+import (
+	"time"
+
+	"github.com/porter-dev/switchboard/pkg/state"
+	"github.com/rs/zerolog"
+)
 
 type ApplyOpts struct {
 	BasePath       string
 	Logger         *zerolog.Logger
 	ResourceLogger *zerolog.Logger
+
+	// MaxParallelism is the maximum number of resources which are operated on
+	// concurrently. If it is less than 1, the number is not limited.
+	MaxParallelism int
+
+	// Atomic rolls back every resource which was applied if any resource in the group
+	// fails to apply. Rollbacks are performed in reverse dependency order.
+	Atomic bool
+
+	// CacheDir is the directory where downloaded charts and indexes are cached. If it
+	// is empty, nothing is cached.
+	CacheDir string
+
+	// ChartIndexTTL is the duration that cached Helm repository indexes are used for
+	// before they are downloaded again
+	ChartIndexTTL time.Duration
+
+	// Prune deletes resources which were previously applied, but have since been
+	// removed from the resource group
+	Prune bool
+
+	// ConfirmPrune is called with a summary of the resources that will be pruned before
+	// anything is removed. If it returns false, no resources are pruned. If it is not set,
+	// resources are pruned without confirmation.
+	ConfirmPrune func(orphans []*state.ResourceState) bool
 }
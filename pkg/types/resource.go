@@ -12,4 +12,28 @@ type Resource struct {
 	Target    map[string]interface{} `json:"target"`
 	Config    map[string]interface{} `json:"config"`
 	DependsOn []string               `json:"depends_on"`
+	Timeout   string                 `json:"timeout"`
+	Wait      *Wait                  `json:"wait"`
+
+	// SourceMask, TargetMask and ConfigMask mark the values in Source, Target and Config
+	// which were decrypted when the resource group was parsed, so that they are treated
+	// as sensitive
+	SourceMask map[string]interface{} `json:"-"`
+	TargetMask map[string]interface{} `json:"-"`
+	ConfigMask map[string]interface{} `json:"-"`
+}
+
+type Wait struct {
+	Conditions []*WaitCondition `json:"conditions"`
+	Rollout    bool             `json:"rollout"`
+	Jobs       bool             `json:"jobs"`
+	JSONPath   string           `json:"jsonpath"`
+	Value      string           `json:"value"`
+	Timeout    string           `json:"timeout"`
+}
+
+type WaitCondition struct {
+	Kind   string `json:"kind"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
 }
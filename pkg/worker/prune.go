@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/porter-dev/switchboard/internal/exec"
+	"github.com/porter-dev/switchboard/internal/query"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/porter-dev/switchboard/pkg/state"
+	"github.com/porter-dev/switchboard/pkg/types"
+)
+
+// getOrphanedResources returns the resources in the state which are no longer declared
+// in the resource group, sorted by name
+func getOrphanedResources(st *state.State, group *types.ResourceGroup) []*state.ResourceState {
+	res := make([]*state.ResourceState, 0)
+
+	if st == nil {
+		return res
+	}
+
+	declared := make(map[string]bool)
+
+	for _, resource := range group.Resources {
+		declared[resource.Name] = true
+	}
+
+	for name, resourceState := range st.Resources {
+		if !declared[name] {
+			res = append(res, resourceState)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res
+}
+
+// prune deletes orphaned resources through the driver they were applied with, in
+// reverse dependency order, and removes them from the state. Errors are returned
+// per resource.
+//
+// Sensitive values were redacted from the state, and orphans are no longer declared, so
+// their values are unknown. Redacted config values are removed before the resource is
+// deleted, and the saved output is passed to the driver, so that it can identify what to
+// delete. Orphans with a redacted source or target cannot be deleted, since the driver
+// cannot be constructed without them.
+func (w *Worker) prune(
+	ctx context.Context,
+	orphans []*state.ResourceState,
+	st *state.State,
+	opts *types.ApplyOpts,
+) map[string]error {
+	isOrphan := make(map[string]bool)
+
+	for _, orphan := range orphans {
+		isOrphan[orphan.Name] = true
+	}
+
+	group := &types.ResourceGroup{
+		Resources: make([]*types.Resource, 0),
+	}
+
+	allErrors := make(map[string]error)
+
+	for _, orphan := range orphans {
+		if query.RedactedMask(orphan.Source) != nil || query.RedactedMask(orphan.Target) != nil {
+			allErrors[orphan.Name] = fmt.Errorf("error pruning resource: its source or target contains sensitive values which were redacted from the state")
+			continue
+		}
+
+		// only keep dependencies on other orphaned resources, since these are the only
+		// resources whose deletion order matters
+		dependsOn := make([]string, 0)
+
+		for _, dep := range orphan.Dependencies {
+			if isOrphan[dep] {
+				dependsOn = append(dependsOn, dep)
+			}
+		}
+
+		group.Resources = append(group.Resources, &types.Resource{
+			Name:      orphan.Name,
+			Driver:    orphan.Driver,
+			Source:    orphan.Source,
+			Target:    orphan.Target,
+			Config:    removeRedacted(orphan.Config),
+			DependsOn: dependsOn,
+		})
+	}
+
+	if len(allErrors) > 0 {
+		return allErrors
+	}
+
+	resources, sharedDriverOpts, allErrors, err := w.getResources(ctx, group, opts)
+
+	if err != nil {
+		return map[string]error{"prune": err}
+	} else if len(allErrors) > 0 {
+		return allErrors
+	}
+
+	for _, resource := range resources {
+		resource.SavedOutput = st.Resources[resource.Name].Output
+	}
+
+	nodes, err := exec.GetReverseExecNodes(&models.ResourceGroup{
+		Resources: resources,
+	})
+
+	if err != nil {
+		return map[string]error{"prune": err}
+	}
+
+	exec.Execute(ctx, nodes, getDeleteExecFunc(sharedDriverOpts, st), &exec.ExecuteOpts{
+		MaxParallelism: opts.MaxParallelism,
+	})
+
+	for _, node := range nodes {
+		if node.ExecError() != nil {
+			allErrors[node.ResourceName()] = fmt.Errorf("error pruning resource: %w", node.ExecError())
+		}
+	}
+
+	// state is saved with a new context, so that resources which were deleted before
+	// cancellation are still removed from it
+	if err := w.saveDeletedState(context.Background(), st, nodes); err != nil {
+		allErrors["state"] = fmt.Errorf("error saving state: %w", err)
+	}
+
+	return allErrors
+}
+
+// removeRedacted returns a copy of the config without the values which were redacted,
+// so that placeholders are never passed to a driver as real values. Redacted values in
+// slices are replaced by nil, so that the indexes of other values are kept.
+func removeRedacted(config map[string]interface{}) map[string]interface{} {
+	res, _ := removeRedactedValue(config).(map[string]interface{})
+
+	return res
+}
+
+func removeRedactedValue(val interface{}) interface{} {
+	switch typedVal := val.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(typedVal))
+
+		for key, nestedVal := range typedVal {
+			if nestedVal, ok := nestedVal.(string); ok && nestedVal == query.Redacted {
+				continue
+			}
+
+			res[key] = removeRedactedValue(nestedVal)
+		}
+
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(typedVal))
+
+		for i, nestedVal := range typedVal {
+			if nestedVal, ok := nestedVal.(string); ok && nestedVal == query.Redacted {
+				continue
+			}
+
+			res[i] = removeRedactedValue(nestedVal)
+		}
+
+		return res
+	}
+
+	return val
+}
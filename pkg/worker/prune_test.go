@@ -0,0 +1,93 @@
+package worker_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/drivers"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/porter-dev/switchboard/pkg/state"
+	"github.com/porter-dev/switchboard/pkg/types"
+	"github.com/porter-dev/switchboard/pkg/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePruneDriver records the config and saved output that it is deleted with
+type fakePruneDriver struct {
+	fakeOutputDriver
+}
+
+func (d *fakePruneDriver) Delete(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	d.events.add(fmt.Sprintf("delete %s with %v and output %v", d.name, resource.Config, resource.SavedOutput))
+
+	return resource, nil
+}
+
+func TestPruneRemovesRedactedConfigValues(t *testing.T) {
+	events := &fakeEvents{}
+
+	w := worker.NewWorker()
+	w.SetStateBackend(state.NewLocalBackend(filepath.Join(t.TempDir(), "switchboard.state.json")))
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakePruneDriver{fakeOutputDriver{fakeDriver: fakeDriver{name: resource.Name, events: events}}}, nil
+	})
+
+	err := w.Apply(context.Background(), &types.ResourceGroup{
+		Version: "v1",
+		Resources: []*types.Resource{
+			{Name: "a", Driver: "fake"},
+			{
+				Name:       "b",
+				Driver:     "fake",
+				Config:     map[string]interface{}{"host": "{ .a.host }", "password": "hunter2"},
+				ConfigMask: map[string]interface{}{"password": true},
+				DependsOn:  []string{"a"},
+			},
+		},
+	}, &types.ApplyOpts{})
+
+	assert.NoError(t, err)
+
+	err = w.Apply(context.Background(), &types.ResourceGroup{
+		Version:   "v1",
+		Resources: []*types.Resource{{Name: "a", Driver: "fake"}},
+	}, &types.ApplyOpts{Prune: true})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"delete b with map[host:db.internal] and output map[host:db.internal]",
+	}, events.events)
+}
+
+func TestPruneRefusesRedactedTarget(t *testing.T) {
+	events := &fakeEvents{}
+
+	w := worker.NewWorker()
+	w.SetStateBackend(state.NewLocalBackend(filepath.Join(t.TempDir(), "switchboard.state.json")))
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakePruneDriver{fakeOutputDriver{fakeDriver: fakeDriver{name: resource.Name, events: events}}}, nil
+	})
+
+	hook := &fakeHook{}
+	w.RegisterHook("test", hook)
+
+	err := w.Apply(context.Background(), &types.ResourceGroup{
+		Version: "v1",
+		Resources: []*types.Resource{{
+			Name:       "a",
+			Driver:     "fake",
+			Target:     map[string]interface{}{"token": "hunter2"},
+			TargetMask: map[string]interface{}{"token": true},
+		}},
+	}, &types.ApplyOpts{})
+
+	assert.NoError(t, err)
+
+	err = w.Apply(context.Background(), &types.ResourceGroup{Version: "v1"}, &types.ApplyOpts{Prune: true})
+
+	assert.Error(t, err)
+	assert.Empty(t, events.events)
+	assert.EqualError(t, hook.errors["a"], "error pruning resource: its source or target contains sensitive values which were redacted from the state")
+}
@@ -0,0 +1,216 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/porter-dev/switchboard/internal/query"
+	"github.com/porter-dev/switchboard/pkg/drivers"
+	"github.com/porter-dev/switchboard/pkg/models"
+)
+
+// SensitiveDataHook is implemented by hooks which need the values of sensitive outputs.
+// If IncludeSensitiveData returns true, PostApply is called with sensitive values as they
+// are. Otherwise, sensitive values are replaced by a placeholder.
+type SensitiveDataHook interface {
+	IncludeSensitiveData() bool
+}
+
+// includeSensitiveData returns true if the hook opted in to receiving sensitive values
+func includeSensitiveData(hook WorkerHook) bool {
+	sensitiveHook, ok := hook.(SensitiveDataHook)
+
+	return ok && sensitiveHook.IncludeSensitiveData()
+}
+
+// redactor records the sensitive values which have been read from outputs, and removes
+// them from text. Values are recorded as resources are applied or planned, so they are
+// redacted from the logs of dependents.
+type redactor struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+func newRedactor() *redactor {
+	return &redactor{
+		values:   make(map[string]bool),
+		replacer: strings.NewReplacer(),
+	}
+}
+
+// add records the values marked as sensitive by the mask
+func (r *redactor) add(val interface{}, mask map[string]interface{}) {
+	if mask == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	added := false
+
+	for _, str := range query.SensitiveStrings(val, mask) {
+		if !r.values[str] {
+			r.values[str] = true
+			added = true
+		}
+	}
+
+	if !added {
+		return
+	}
+
+	// values are replaced longest first, so that values which contain other values are
+	// redacted as a whole. Values are also replaced in their JSON-escaped form, since
+	// log fields may be escaped.
+	values := make([]string, 0, len(r.values))
+
+	for str := range r.values {
+		values = append(values, str)
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+
+	oldnew := make([]string, 0)
+
+	for _, str := range values {
+		oldnew = append(oldnew, str, query.Redacted)
+
+		escapedBytes, _ := json.Marshal(str)
+
+		if escaped := string(escapedBytes[1 : len(escapedBytes)-1]); escaped != str {
+			oldnew = append(oldnew, escaped, query.Redacted)
+		}
+	}
+
+	r.replacer = strings.NewReplacer(oldnew...)
+}
+
+// addOutput records the sensitive values in the output of a driver. Outputs which cannot
+// be read are skipped, since the error is returned when the output is used.
+func (r *redactor) addOutput(ctx context.Context, driver drivers.Driver) {
+	output, mask, err := drivers.GetOutput(ctx, driver)
+
+	if err != nil {
+		return
+	}
+
+	r.add(output, mask)
+}
+
+// addConfig records the values in the constructed config of a resource which its driver
+// marks as sensitive. Configs which cannot be constructed are skipped, since the error
+// is returned when the resource is applied or planned.
+func (r *redactor) addConfig(
+	ctx context.Context,
+	driver drivers.Driver,
+	resource *models.Resource,
+	lookupTable map[string]drivers.Driver,
+) {
+	sensitiveDriver, ok := driver.(drivers.SensitiveConfigDriver)
+
+	if !ok {
+		return
+	}
+
+	mask, err := sensitiveDriver.SensitiveConfig(ctx, resource)
+
+	if err != nil || mask == nil {
+		return
+	}
+
+	config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
+		RawConf:      resource.Config,
+		RawConfMask:  resource.ConfigMask,
+		LookupTable:  lookupTable,
+		Dependencies: resource.Dependencies,
+	})
+
+	if err != nil {
+		return
+	}
+
+	r.add(config, mask)
+}
+
+// redact replaces every recorded sensitive value in the text
+func (r *redactor) redact(text string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.replacer.Replace(text)
+}
+
+// redactValue returns a copy of the value in which every recorded sensitive value is
+// redacted from each string
+func (r *redactor) redactValue(val interface{}) interface{} {
+	switch typedVal := val.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(typedVal))
+
+		for key, nestedVal := range typedVal {
+			res[key] = r.redactValue(nestedVal)
+		}
+
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(typedVal))
+
+		for i, nestedVal := range typedVal {
+			res[i] = r.redactValue(nestedVal)
+		}
+
+		return res
+	case string:
+		return r.redact(typedVal)
+	}
+
+	return val
+}
+
+// redactError returns an error whose message has every recorded sensitive value
+// redacted. The original error is not wrapped, so that it cannot be unwrapped to read
+// the values. Errors without sensitive values are returned as they are.
+func (r *redactor) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+
+	if redacted := r.redact(msg); redacted != msg {
+		return errors.New(redacted)
+	}
+
+	return err
+}
+
+// writer returns a writer which redacts every recorded sensitive value before writing to
+// out. Each write should contain whole log lines, so that values are not split between
+// writes.
+func (r *redactor) writer(out io.Writer) io.Writer {
+	return &redactingWriter{r, out}
+}
+
+type redactingWriter struct {
+	redactor *redactor
+	out      io.Writer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(w.out, w.redactor.redact(string(p)))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
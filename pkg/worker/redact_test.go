@@ -0,0 +1,301 @@
+package worker_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/porter-dev/switchboard/pkg/drivers"
+	"github.com/porter-dev/switchboard/pkg/encryption"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/porter-dev/switchboard/pkg/parser"
+	"github.com/porter-dev/switchboard/pkg/secrets"
+	"github.com/porter-dev/switchboard/pkg/state"
+	"github.com/porter-dev/switchboard/pkg/types"
+	"github.com/porter-dev/switchboard/pkg/worker"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSensitiveDriver struct {
+	fakeDriver
+}
+
+func (d *fakeSensitiveDriver) Output(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"host":     "db.internal",
+		"password": "hunter2",
+	}, nil
+}
+
+func (d *fakeSensitiveDriver) SensitiveOutput(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{"password": true}, nil
+}
+
+type fakeDataHook struct {
+	fakeHook
+	includeSensitive bool
+	data             map[string]interface{}
+}
+
+func (h *fakeDataHook) DataQueries() map[string]interface{} {
+	return map[string]interface{}{
+		"host":     "{ .rds.host }",
+		"password": "{ .rds.password }",
+	}
+}
+
+func (h *fakeDataHook) PostApply(populatedData map[string]interface{}) error {
+	h.data = populatedData
+	return nil
+}
+
+func (h *fakeDataHook) IncludeSensitiveData() bool {
+	return h.includeSensitive
+}
+
+func TestHooksReceiveRedactedData(t *testing.T) {
+	w := worker.NewWorker()
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakeSensitiveDriver{fakeDriver{name: resource.Name, events: &fakeEvents{}}}, nil
+	})
+
+	redactedHook := &fakeDataHook{}
+	sensitiveHook := &fakeDataHook{includeSensitive: true}
+
+	w.RegisterHook("redacted", redactedHook)
+	w.RegisterHook("sensitive", sensitiveHook)
+
+	err := w.Apply(context.Background(), &types.ResourceGroup{
+		Version:   "v1",
+		Resources: []*types.Resource{{Name: "rds", Driver: "fake"}},
+	}, &types.ApplyOpts{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"host":     "db.internal",
+		"password": "(sensitive value)",
+	}, redactedHook.data)
+	assert.Equal(t, map[string]interface{}{
+		"host":     "db.internal",
+		"password": "hunter2",
+	}, sensitiveHook.data)
+}
+
+type fakeConfigDriver struct {
+	fakeDriver
+}
+
+func (d *fakeConfigDriver) Apply(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	return nil, fmt.Errorf("could not connect with password %s", resource.Config["password"])
+}
+
+func TestSecretsAreRedactedFromErrors(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "hunter2")
+
+	w := worker.NewWorker()
+	w.RegisterSecretProvider("env", &secrets.EnvProvider{})
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakeConfigDriver{fakeDriver{name: resource.Name, events: &fakeEvents{}}}, nil
+	})
+
+	redactedHook := &fakeDataHook{}
+	sensitiveHook := &fakeDataHook{includeSensitive: true}
+
+	w.RegisterHook("redacted", redactedHook)
+	w.RegisterHook("sensitive", sensitiveHook)
+
+	err := w.Apply(context.Background(), &types.ResourceGroup{
+		Version: "v1",
+		Resources: []*types.Resource{{
+			Name:   "app",
+			Driver: "fake",
+			Config: map[string]interface{}{"password": "{ secret:env.DB_PASSWORD }"},
+		}},
+	}, &types.ApplyOpts{})
+
+	assert.Error(t, err)
+	assert.EqualError(t, redactedHook.errors["app"], "could not connect with password (sensitive value)")
+	assert.EqualError(t, sensitiveHook.errors["app"], "could not connect with password hunter2")
+}
+
+type fakeSensitiveConfigDriver struct {
+	fakeConfigDriver
+}
+
+func (d *fakeSensitiveConfigDriver) SensitiveConfig(ctx context.Context, resource *models.Resource) (map[string]interface{}, error) {
+	return map[string]interface{}{"password": true}, nil
+}
+
+func TestSensitiveConfigIsRedactedFromErrors(t *testing.T) {
+	w := worker.NewWorker()
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakeSensitiveConfigDriver{fakeConfigDriver{fakeDriver{name: resource.Name, events: &fakeEvents{}}}}, nil
+	})
+
+	redactedHook := &fakeDataHook{}
+
+	w.RegisterHook("redacted", redactedHook)
+
+	err := w.Apply(context.Background(), &types.ResourceGroup{
+		Version: "v1",
+		Resources: []*types.Resource{{
+			Name:   "app",
+			Driver: "fake",
+			Config: map[string]interface{}{"password": "hunter2"},
+		}},
+	}, &types.ApplyOpts{})
+
+	assert.Error(t, err)
+	assert.EqualError(t, redactedHook.errors["app"], "could not connect with password (sensitive value)")
+}
+
+func TestDecryptedValuesAreNotSaved(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "switchboard.state.json")
+
+	w := worker.NewWorker()
+	w.SetStateBackend(state.NewLocalBackend(statePath))
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakeDriver{name: resource.Name, events: &fakeEvents{}}, nil
+	})
+
+	err := w.Apply(context.Background(), &types.ResourceGroup{
+		Version: "v1",
+		Resources: []*types.Resource{{
+			Name:       "app",
+			Driver:     "fake",
+			Config:     map[string]interface{}{"username": "admin", "password": "hunter2"},
+			ConfigMask: map[string]interface{}{"password": true},
+		}},
+	}, &types.ApplyOpts{})
+
+	assert.NoError(t, err)
+
+	stateBytes, err := ioutil.ReadFile(statePath)
+
+	assert.NoError(t, err)
+	assert.NotContains(t, string(stateBytes), "hunter2")
+
+	st, err := state.NewLocalBackend(statePath).Load(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"username": "admin",
+		"password": "(sensitive value)",
+	}, st.Resources["app"].Config)
+}
+
+// fakeLoggingDriver logs the token in its target when it is applied
+type fakeLoggingDriver struct {
+	fakeDriver
+	logger *zerolog.Logger
+}
+
+func (d *fakeLoggingDriver) Apply(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	d.logger.Info().Msg(fmt.Sprintf("authenticating with token %s", resource.Target["token"]))
+
+	return resource, nil
+}
+
+func TestDecryptedTargetIsNotSavedOrLogged(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := encryption.EncryptValue("hunter2", identity.Recipient())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := parser.ParseEncryptedBytes([]byte(`version: v1
+resources:
+- name: app
+  driver: fake
+  target:
+    token: |
+      `+strings.ReplaceAll(strings.TrimSpace(token), "\n", "\n      ")+`
+`), encryption.NewDecrypter(identity))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statePath := filepath.Join(t.TempDir(), "switchboard.state.json")
+
+	w := worker.NewWorker()
+	w.SetStateBackend(state.NewLocalBackend(statePath))
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakeLoggingDriver{fakeDriver{name: resource.Name, events: &fakeEvents{}}, opts.Logger}, nil
+	})
+
+	// the worker logs to stdout, so it is captured while applying
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+
+	err = w.Apply(context.Background(), group, &types.ApplyOpts{})
+
+	os.Stdout = stdout
+	writer.Close()
+
+	assert.NoError(t, err)
+
+	logBytes, err := ioutil.ReadAll(reader)
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(logBytes), "authenticating with token (sensitive value)")
+	assert.NotContains(t, string(logBytes), "hunter2")
+
+	stateBytes, err := ioutil.ReadFile(statePath)
+
+	assert.NoError(t, err)
+	assert.NotContains(t, string(stateBytes), "hunter2")
+
+	st, err := state.NewLocalBackend(statePath).Load(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"token": "(sensitive value)"}, st.Resources["app"].Target)
+}
+
+func TestSensitiveOutputIsRedactedInState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "switchboard.state.json")
+
+	w := worker.NewWorker()
+	w.SetStateBackend(state.NewLocalBackend(statePath))
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakeSensitiveDriver{fakeDriver{name: resource.Name, events: &fakeEvents{}}}, nil
+	})
+
+	err := w.Apply(context.Background(), &types.ResourceGroup{
+		Version:   "v1",
+		Resources: []*types.Resource{{Name: "rds", Driver: "fake"}},
+	}, &types.ApplyOpts{})
+
+	assert.NoError(t, err)
+
+	stateBytes, err := ioutil.ReadFile(statePath)
+
+	assert.NoError(t, err)
+	assert.NotContains(t, string(stateBytes), "hunter2")
+
+	st, err := state.NewLocalBackend(statePath).Load(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"host":     "db.internal",
+		"password": "(sensitive value)",
+	}, st.Resources["rds"].Output)
+}
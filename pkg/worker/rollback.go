@@ -0,0 +1,299 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/porter-dev/switchboard/internal/exec"
+	"github.com/porter-dev/switchboard/internal/query"
+	"github.com/porter-dev/switchboard/pkg/drivers"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/porter-dev/switchboard/pkg/state"
+	"github.com/porter-dev/switchboard/pkg/types"
+)
+
+// appliedResources records the resources which were applied during an atomic apply,
+// so that they can be rolled back if the resource group fails to apply
+type appliedResources struct {
+	mu        sync.Mutex
+	resources []*models.Resource
+}
+
+func (a *appliedResources) add(resource *models.Resource) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.resources = append(a.resources, resource)
+}
+
+// checkRollbackSupport returns an error for each resource whose driver cannot be
+// rolled back
+func checkRollbackSupport(resources []*models.Resource, opts *drivers.SharedDriverOpts) map[string]error {
+	allErrors := make(map[string]error)
+	lookupTable := *opts.DriverLookupTable
+
+	for _, resource := range resources {
+		if _, ok := lookupTable[resource.Name].(drivers.RollbackDriver); !ok {
+			allErrors[resource.Name] = fmt.Errorf("driver does not support rollback, which is required for atomic applies")
+		}
+	}
+
+	return allErrors
+}
+
+// rollback restores every applied resource to the revision that was recorded before it
+// was applied, in reverse dependency order. A result is returned for each resource that
+// was rolled back, and resources which were rolled back successfully are reported as
+// well, since their changes were not applied.
+func (w *Worker) rollback(
+	applied *appliedResources,
+	st *state.State,
+	sharedDriverOpts *drivers.SharedDriverOpts,
+	opts *types.ApplyOpts,
+) map[string]error {
+	res := make(map[string]error)
+
+	if len(applied.resources) == 0 {
+		return res
+	}
+
+	isApplied := make(map[string]bool)
+
+	for _, resource := range applied.resources {
+		isApplied[resource.Name] = true
+	}
+
+	resources := make([]*models.Resource, 0)
+
+	for _, resource := range applied.resources {
+		// only keep dependencies on other applied resources, since these are the only
+		// resources whose rollback order matters
+		dependsOn := make([]string, 0)
+
+		for _, dep := range resource.Dependencies {
+			if isApplied[dep] {
+				dependsOn = append(dependsOn, dep)
+			}
+		}
+
+		rollbackResource := *resource
+		rollbackResource.Dependencies = dependsOn
+
+		resources = append(resources, &rollbackResource)
+	}
+
+	nodes, err := exec.GetReverseExecNodes(&models.ResourceGroup{
+		Resources: resources,
+	})
+
+	if err != nil {
+		return map[string]error{"rollback": err}
+	}
+
+	// resources are rolled back with a new context, so that a cancelled apply is
+	// still rolled back
+	exec.Execute(context.Background(), nodes, getRollbackExecFunc(st, sharedDriverOpts, w.resolveSecrets), &exec.ExecuteOpts{
+		MaxParallelism: opts.MaxParallelism,
+	})
+
+	for _, node := range nodes {
+		if node.ExecError() != nil {
+			res[node.ResourceName()] = fmt.Errorf("error rolling back resource: %w", node.ExecError())
+		} else {
+			res[node.ResourceName()] = fmt.Errorf("resource was rolled back to its previous revision")
+		}
+	}
+
+	return res
+}
+
+// getRollbackExecFunc returns the function which rolls back each resource to the revision
+// recorded in the state, which is restored by restorePreviousResource.
+func getRollbackExecFunc(
+	st *state.State,
+	opts *drivers.SharedDriverOpts,
+	resolveSecrets func(
+		ctx context.Context,
+		config map[string]interface{},
+	) (map[string]interface{}, map[string]interface{}, error),
+) exec.ExecFunc {
+	return func(ctx context.Context, resource *models.Resource) error {
+		if resource.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, resource.Timeout)
+			defer cancel()
+		}
+
+		opts.Logger.Info().Msg(
+			fmt.Sprintf("running rollback for resource %s", resource.Name),
+		)
+
+		lookupTable := *opts.DriverLookupTable
+		driver := lookupTable[resource.Name].(drivers.RollbackDriver)
+
+		previous := getPreviousResource(st, resource, lookupTable)
+
+		if previous != nil {
+			var err error
+
+			previous, err = restorePreviousResource(ctx, previous, resource, resolveSecrets)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := driver.Rollback(ctx, resource, previous)
+		if err != nil {
+			return err
+		}
+
+		opts.Logger.Info().Msg(
+			fmt.Sprintf("successfully rolled back resource %s", resource.Name),
+		)
+
+		return nil
+	}
+}
+
+// getPreviousResource returns the resource as it was last applied, or nil if there is no
+// state for it. Dependencies which are no longer part of the resource group are dropped,
+// since their output cannot be read.
+func getPreviousResource(
+	st *state.State,
+	resource *models.Resource,
+	lookupTable map[string]drivers.Driver,
+) *models.Resource {
+	if st == nil {
+		return nil
+	}
+
+	previous, ok := st.Resources[resource.Name]
+
+	if !ok {
+		return nil
+	}
+
+	dependsOn := make([]string, 0)
+
+	for _, dep := range previous.Dependencies {
+		if _, ok := lookupTable[dep]; ok {
+			dependsOn = append(dependsOn, dep)
+		}
+	}
+
+	return &models.Resource{
+		Name:           resource.Name,
+		Driver:         resource.Driver,
+		Source:         previous.Source,
+		DeclaredSource: previous.Source,
+		Target:         previous.Target,
+		DeclaredTarget: previous.Target,
+		Config:         previous.Config,
+		DeclaredConfig: previous.Config,
+		DecryptedHash:  previous.DecryptedHash,
+		Dependencies:   dependsOn,
+		Timeout:        resource.Timeout,
+	}
+}
+
+// restorePreviousResource returns the previous resource with its redacted values restored
+// and its secret references resolved. Decrypted values are redacted from the state, so
+// they are replaced by the values at the same keys of the current resource. This is only
+// correct if the values are unchanged, which is checked against the hash of the decrypted
+// values recorded in the state. If they changed, nil is returned, since the values that
+// the resource was previously applied with are unknown.
+func restorePreviousResource(
+	ctx context.Context,
+	previous *models.Resource,
+	current *models.Resource,
+	resolveSecrets func(
+		ctx context.Context,
+		config map[string]interface{},
+	) (map[string]interface{}, map[string]interface{}, error),
+) (*models.Resource, error) {
+	declared := map[string]interface{}{
+		"source": previous.DeclaredSource,
+		"target": previous.DeclaredTarget,
+		"config": previous.DeclaredConfig,
+	}
+
+	redactedMask, _ := query.RedactedMask(declared).(map[string]interface{})
+
+	restored := restoreRedacted(declared, map[string]interface{}{
+		"source": current.Source,
+		"target": current.Target,
+		"config": current.Config,
+	})
+
+	decryptedHash, err := hashMaskedValues(restored, redactedMask)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if decryptedHash != previous.DecryptedHash {
+		return nil, nil
+	}
+
+	config, _ := restored["config"].(map[string]interface{})
+	config, configMask, err := resolveSecrets(ctx, config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	redactedConfigMask, _ := redactedMask["config"].(map[string]interface{})
+
+	res := *previous
+	res.Source, _ = restored["source"].(map[string]interface{})
+	res.Target, _ = restored["target"].(map[string]interface{})
+	res.Config = config
+	res.ConfigMask = query.MergeMasks(redactedConfigMask, configMask)
+
+	return &res, nil
+}
+
+// restoreRedacted returns a copy of val in which every redacted value is replaced by the
+// value at the same key or index of current. Redacted values which are not in current
+// are kept.
+func restoreRedacted(val interface{}, current interface{}) map[string]interface{} {
+	res, _ := restoreRedactedValue(val, current).(map[string]interface{})
+
+	return res
+}
+
+func restoreRedactedValue(val interface{}, current interface{}) interface{} {
+	switch typedVal := val.(type) {
+	case map[string]interface{}:
+		currentMap, _ := current.(map[string]interface{})
+		res := make(map[string]interface{}, len(typedVal))
+
+		for key, nestedVal := range typedVal {
+			res[key] = restoreRedactedValue(nestedVal, currentMap[key])
+		}
+
+		return res
+	case []interface{}:
+		currentSlice, _ := current.([]interface{})
+		res := make([]interface{}, len(typedVal))
+
+		for i, nestedVal := range typedVal {
+			var nestedCurrent interface{}
+
+			if i < len(currentSlice) {
+				nestedCurrent = currentSlice[i]
+			}
+
+			res[i] = restoreRedactedValue(nestedVal, nestedCurrent)
+		}
+
+		return res
+	case string:
+		if typedVal == query.Redacted && current != nil {
+			return current
+		}
+	}
+
+	return val
+}
@@ -0,0 +1,277 @@
+package worker_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/drivers"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/porter-dev/switchboard/pkg/state"
+	"github.com/porter-dev/switchboard/pkg/types"
+	"github.com/porter-dev/switchboard/pkg/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *fakeEvents) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.events = append(e.events, event)
+}
+
+type fakeDriver struct {
+	name   string
+	fail   bool
+	events *fakeEvents
+}
+
+func (d *fakeDriver) ShouldApply(ctx context.Context, resource *models.Resource) bool {
+	return true
+}
+
+func (d *fakeDriver) Apply(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	if d.fail {
+		return nil, fmt.Errorf("apply failed")
+	}
+
+	d.events.add("apply " + d.name)
+
+	return resource, nil
+}
+
+func (d *fakeDriver) Plan(ctx context.Context, resource *models.Resource) (*drivers.Plan, error) {
+	return &drivers.Plan{Action: drivers.PlanActionNoop}, nil
+}
+
+func (d *fakeDriver) Delete(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	return resource, nil
+}
+
+func (d *fakeDriver) Output(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func (d *fakeDriver) Checkpoint(ctx context.Context, resource *models.Resource) error {
+	d.events.add("checkpoint " + d.name)
+	return nil
+}
+
+func (d *fakeDriver) Rollback(ctx context.Context, current, previous *models.Resource) error {
+	if previous == nil {
+		d.events.add("rollback " + d.name)
+	} else {
+		d.events.add(fmt.Sprintf("rollback %s to %v", d.name, previous.Config))
+	}
+
+	return nil
+}
+
+type fakeHook struct {
+	errors map[string]error
+}
+
+func (h *fakeHook) PreApply() error                                      { return nil }
+func (h *fakeHook) DataQueries() map[string]interface{}                  { return nil }
+func (h *fakeHook) PostApply(populatedData map[string]interface{}) error { return nil }
+func (h *fakeHook) OnError(err error)                                    {}
+func (h *fakeHook) OnConsolidatedErrors(allErrors map[string]error) {
+	h.errors = allErrors
+}
+
+func TestAtomicApplyRollsBackInReverseOrder(t *testing.T) {
+	events := &fakeEvents{}
+
+	w := worker.NewWorker()
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakeDriver{
+			name:   resource.Name,
+			fail:   resource.Name == "c",
+			events: events,
+		}, nil
+	})
+
+	hook := &fakeHook{}
+	w.RegisterHook("test", hook)
+
+	group := &types.ResourceGroup{
+		Version: "v1",
+		Resources: []*types.Resource{
+			{Name: "a", Driver: "fake"},
+			{Name: "b", Driver: "fake", DependsOn: []string{"a"}},
+			{Name: "c", Driver: "fake", DependsOn: []string{"b"}},
+		},
+	}
+
+	err := w.Apply(context.Background(), group, &types.ApplyOpts{
+		Atomic: true,
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{
+		"checkpoint a", "apply a",
+		"checkpoint b", "apply b",
+		"checkpoint c",
+		"rollback b", "rollback a",
+	}, events.events)
+
+	assert.Len(t, hook.errors, 3)
+	assert.EqualError(t, hook.errors["c"], "apply failed")
+	assert.Contains(t, hook.errors["a"].Error(), "rolled back")
+	assert.Contains(t, hook.errors["b"].Error(), "rolled back")
+}
+
+// fakeReapplyDriver rolls back by applying the previous config again, like the
+// Terraform driver
+type fakeReapplyDriver struct {
+	fakeDriver
+}
+
+func (d *fakeReapplyDriver) Rollback(ctx context.Context, current, previous *models.Resource) error {
+	if previous == nil {
+		return fmt.Errorf("the previous config of %s is unknown", current.Name)
+	}
+
+	d.events.add(fmt.Sprintf("apply %s with %v", d.name, previous.Config))
+
+	return nil
+}
+
+func TestAtomicApplyWithoutStateDoesNotReapplyCurrentConfig(t *testing.T) {
+	events := &fakeEvents{}
+
+	w := worker.NewWorker()
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakeReapplyDriver{fakeDriver{
+			name:   resource.Name,
+			fail:   resource.Name == "b",
+			events: events,
+		}}, nil
+	})
+
+	hook := &fakeHook{}
+	w.RegisterHook("test", hook)
+
+	err := w.Apply(context.Background(), &types.ResourceGroup{
+		Version: "v1",
+		Resources: []*types.Resource{
+			{Name: "a", Driver: "fake", Config: map[string]interface{}{"version": 2}},
+			{Name: "b", Driver: "fake", DependsOn: []string{"a"}},
+		},
+	}, &types.ApplyOpts{
+		Atomic: true,
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"checkpoint a", "apply a", "checkpoint b"}, events.events)
+	assert.EqualError(t, hook.errors["a"], "error rolling back resource: the previous config of a is unknown")
+}
+
+func TestAtomicApplyRollsBackToPreviousConfig(t *testing.T) {
+	events := &fakeEvents{}
+
+	w := worker.NewWorker()
+	w.SetStateBackend(state.NewLocalBackend(filepath.Join(t.TempDir(), "switchboard.state.json")))
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakeReapplyDriver{fakeDriver{
+			name:   resource.Name,
+			fail:   resource.Name == "b",
+			events: events,
+		}}, nil
+	})
+
+	resourceA := &types.Resource{Name: "a", Driver: "fake", Config: map[string]interface{}{"version": 1}}
+
+	err := w.Apply(context.Background(), &types.ResourceGroup{
+		Version:   "v1",
+		Resources: []*types.Resource{resourceA},
+	}, &types.ApplyOpts{})
+
+	assert.NoError(t, err)
+
+	resourceA.Config = map[string]interface{}{"version": 2}
+	events.events = nil
+
+	err = w.Apply(context.Background(), &types.ResourceGroup{
+		Version: "v1",
+		Resources: []*types.Resource{
+			resourceA,
+			{Name: "b", Driver: "fake", DependsOn: []string{"a"}},
+		},
+	}, &types.ApplyOpts{
+		Atomic: true,
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"checkpoint a", "apply a", "checkpoint b", "apply a with map[version:1]"}, events.events)
+}
+
+func TestAtomicApplyRollsBackEncryptedValuesOnlyIfUnchanged(t *testing.T) {
+	events := &fakeEvents{}
+
+	w := worker.NewWorker()
+	w.SetStateBackend(state.NewLocalBackend(filepath.Join(t.TempDir(), "switchboard.state.json")))
+	w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+		return &fakeReapplyDriver{fakeDriver{
+			name:   resource.Name,
+			fail:   resource.Name == "b",
+			events: events,
+		}}, nil
+	})
+
+	resourceA := &types.Resource{
+		Name:       "a",
+		Driver:     "fake",
+		Config:     map[string]interface{}{"version": 1, "password": "hunter2"},
+		ConfigMask: map[string]interface{}{"password": true},
+	}
+
+	err := w.Apply(context.Background(), &types.ResourceGroup{
+		Version:   "v1",
+		Resources: []*types.Resource{resourceA},
+	}, &types.ApplyOpts{})
+
+	assert.NoError(t, err)
+
+	group := &types.ResourceGroup{
+		Version: "v1",
+		Resources: []*types.Resource{
+			resourceA,
+			{Name: "b", Driver: "fake", DependsOn: []string{"a"}},
+		},
+	}
+
+	// the decrypted password is unchanged, so it is restored from the current config
+	resourceA.Config = map[string]interface{}{"version": 2, "password": "hunter2"}
+	events.events = nil
+
+	err = w.Apply(context.Background(), group, &types.ApplyOpts{Atomic: true})
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{
+		"checkpoint a",
+		"apply a",
+		"checkpoint b",
+		"apply a with map[password:hunter2 version:1]",
+	}, events.events)
+
+	// the previous password is unknown, so the previous config cannot be applied
+	resourceA.Config = map[string]interface{}{"version": 2, "password": "hunter3"}
+	events.events = nil
+
+	hook := &fakeHook{}
+	w.RegisterHook("test", hook)
+
+	err = w.Apply(context.Background(), group, &types.ApplyOpts{Atomic: true})
+
+	assert.Error(t, err)
+	assert.Equal(t, []string{"checkpoint a", "apply a", "checkpoint b"}, events.events)
+	assert.EqualError(t, hook.errors["a"], "error rolling back resource: the previous config of a is unknown")
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/porter-dev/switchboard/internal/exec"
+	"github.com/porter-dev/switchboard/internal/query"
+	"github.com/porter-dev/switchboard/pkg/drivers"
+	"github.com/porter-dev/switchboard/pkg/state"
+)
+
+// SetStateBackend sets the backend used to persist the state of applied resources
+// between runs. If no backend is set, no state is persisted.
+func (w *Worker) SetStateBackend(backend state.Backend) {
+	w.stateBackend = backend
+}
+
+// loadState reads the state from the backend, returning nil if no backend is set
+func (w *Worker) loadState(ctx context.Context) (*state.State, error) {
+	if w.stateBackend == nil {
+		return nil, nil
+	}
+
+	return w.stateBackend.Load(ctx)
+}
+
+// saveAppliedState records the state of each resource that was applied successfully,
+// and writes the state to the backend. Resources which failed keep their previous state.
+func (w *Worker) saveAppliedState(
+	ctx context.Context,
+	st *state.State,
+	nodes []*exec.ExecNode,
+	opts *drivers.SharedDriverOpts,
+) error {
+	if w.stateBackend == nil {
+		return nil
+	}
+
+	lookupTable := *opts.DriverLookupTable
+
+	for _, node := range nodes {
+		if node.ExecError() != nil {
+			continue
+		}
+
+		resource := node.Resource()
+		driver := lookupTable[resource.Name]
+
+		config, err := drivers.ConstructConfig(ctx, &drivers.ConstructConfigOpts{
+			RawConf:      resource.Config,
+			RawConfMask:  resource.ConfigMask,
+			LookupTable:  lookupTable,
+			Dependencies: resource.Dependencies,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		configHash, err := state.HashConfig(config)
+
+		if err != nil {
+			return err
+		}
+
+		output, outputMask, err := drivers.GetOutput(ctx, driver)
+
+		if err != nil {
+			return err
+		}
+
+		driverName := resource.Driver
+
+		if driverName == "" {
+			driverName = w.defaultDriver
+		}
+
+		st.Resources[resource.Name] = &state.ResourceState{
+			Name:          resource.Name,
+			Driver:        driverName,
+			Source:        resource.DeclaredSource,
+			Target:        resource.DeclaredTarget,
+			Config:        resource.DeclaredConfig,
+			Dependencies:  resource.Dependencies,
+			ConfigHash:    configHash,
+			DecryptedHash: resource.DecryptedHash,
+			Output:        w.redactOutput(output, outputMask),
+			OutputMask:    outputMask,
+			AppliedAt:     time.Now().UTC(),
+		}
+	}
+
+	return w.stateBackend.Save(ctx, st)
+}
+
+// saveDeletedState removes each resource that was deleted successfully from the state,
+// and writes the state to the backend.
+func (w *Worker) saveDeletedState(ctx context.Context, st *state.State, nodes []*exec.ExecNode) error {
+	if w.stateBackend == nil {
+		return nil
+	}
+
+	for _, node := range nodes {
+		if node.ExecError() == nil {
+			delete(st.Resources, node.ResourceName())
+		}
+	}
+
+	return w.stateBackend.Save(ctx, st)
+}
+
+// redactOutput returns a copy of the output in which the values marked by the mask, and
+// every other recorded sensitive value, are redacted. Outputs are saved to the state in
+// this form, so that sensitive values are never written to the backend.
+func (w *Worker) redactOutput(output map[string]interface{}, outputMask map[string]interface{}) map[string]interface{} {
+	res, _ := w.redactor.redactValue(query.Redact(output, outputMask)).(map[string]interface{})
+
+	return res
+}
+
+// hashMaskedValues returns a hash of the values in val which are marked by the mask, or an
+// empty string if no values are marked
+func hashMaskedValues(val interface{}, mask interface{}) (string, error) {
+	selected, ok := query.Select(val, mask).(map[string]interface{})
+
+	if !ok {
+		return "", nil
+	}
+
+	return state.HashConfig(selected)
+}
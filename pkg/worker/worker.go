@@ -1,13 +1,18 @@
 package worker
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/porter-dev/switchboard/internal/exec"
 	"github.com/porter-dev/switchboard/internal/query"
 	"github.com/porter-dev/switchboard/pkg/drivers"
 	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/porter-dev/switchboard/pkg/secrets"
+	"github.com/porter-dev/switchboard/pkg/state"
 	"github.com/porter-dev/switchboard/pkg/types"
 	"github.com/rs/zerolog"
 )
@@ -20,6 +25,13 @@ type Worker struct {
 	driversTable  map[string]drivers.DriverFunc
 	hooks         []hookWithName
 	defaultDriver string
+	stateBackend  state.Backend
+
+	// redactor removes sensitive values from logs and plans
+	redactor *redactor
+
+	// secrets resolves secret references in resource configs
+	secrets *secrets.Resolver
 }
 
 func NewWorker() *Worker {
@@ -27,6 +39,8 @@ func NewWorker() *Worker {
 		driversTable:  make(map[string]drivers.DriverFunc),
 		hooks:         make([]hookWithName, 0),
 		defaultDriver: "",
+		redactor:      newRedactor(),
+		secrets:       secrets.NewResolver(),
 	}
 }
 
@@ -50,6 +64,12 @@ func (w *Worker) SetDefaultDriver(name string) error {
 	return nil
 }
 
+// RegisterSecretProvider registers the provider which resolves secret references of the
+// given kind, like env in { secret:env.DB_PASSWORD }
+func (w *Worker) RegisterSecretProvider(kind string, provider secrets.SecretProvider) error {
+	return w.secrets.RegisterProvider(kind, provider)
+}
+
 type WorkerHook interface {
 	PreApply() error
 	DataQueries() map[string]interface{}
@@ -68,7 +88,7 @@ func (w *Worker) RegisterHook(name string, hook WorkerHook) error {
 }
 
 // Apply creates a ResourceGroup
-func (w *Worker) Apply(group *types.ResourceGroup, opts *types.ApplyOpts) error {
+func (w *Worker) Apply(ctx context.Context, group *types.ResourceGroup, opts *types.ApplyOpts) error {
 	allErrors := make(map[string]error)
 
 	// run any pre-apply hooks
@@ -80,45 +100,396 @@ func (w *Worker) Apply(group *types.ResourceGroup, opts *types.ApplyOpts) error
 	}
 
 	if len(allErrors) > 0 {
-		for _, hook := range w.hooks {
-			hook.OnConsolidatedErrors(allErrors)
+		w.runConsolidatedErrorHooks(allErrors)
+
+		return fmt.Errorf("errors were encountered with one or more hooks")
+	}
+
+	st, err := w.loadState(ctx)
+
+	if err != nil {
+		err = fmt.Errorf("error loading state: %w", err)
+		w.runErrorHooks(err)
+		return err
+	}
+
+	// find resources which were removed from the resource group since the last apply
+	orphans := getOrphanedResources(st, group)
+	shouldPrune := false
+
+	if len(orphans) > 0 && opts.Prune {
+		shouldPrune = opts.ConfirmPrune == nil || opts.ConfirmPrune(orphans)
+	}
+
+	resources, sharedDriverOpts, allErrors, err := w.getResources(ctx, group, opts)
+
+	if err != nil {
+		w.runErrorHooks(err)
+		return err
+	} else if len(allErrors) > 0 {
+		w.runConsolidatedErrorHooks(allErrors)
+
+		return fmt.Errorf("errors were encountered with one or more resources")
+	}
+
+	if opts.Atomic {
+		allErrors = checkRollbackSupport(resources, sharedDriverOpts)
+
+		if len(allErrors) > 0 {
+			w.runConsolidatedErrorHooks(allErrors)
+
+			return fmt.Errorf("errors were encountered with one or more resources")
+		}
+	}
+
+	if len(orphans) > 0 && !shouldPrune {
+		for _, orphan := range orphans {
+			sharedDriverOpts.Logger.Warn().Msg(
+				fmt.Sprintf("resource %s was removed from the resource group but was not pruned", orphan.Name),
+			)
+		}
+	}
+
+	nodes, err := exec.GetExecNodes(&models.ResourceGroup{
+		APIVersion: group.Version,
+		Resources:  resources,
+	})
+	if err != nil {
+		w.runErrorHooks(err)
+		return err
+	}
+
+	lookupTable := *sharedDriverOpts.DriverLookupTable
+
+	var applied *appliedResources
+
+	if opts.Atomic {
+		applied = &appliedResources{}
+	}
+
+	execFunc := getExecFunc(sharedDriverOpts, applied, w.redactor)
+
+	exec.Execute(ctx, nodes, execFunc, &exec.ExecuteOpts{
+		MaxParallelism: opts.MaxParallelism,
+	})
+
+	for _, node := range nodes {
+		if node.ExecError() != nil {
+			allErrors[node.ResourceName()] = node.ExecError()
+		}
+	}
+
+	savedNodes := nodes
+
+	// in atomic mode, roll back every applied resource if any resource failed. Resources
+	// which were rolled back keep their previous state.
+	if opts.Atomic && len(allErrors) > 0 {
+		rollbackResults := w.rollback(applied, st, sharedDriverOpts, opts)
+		savedNodes = make([]*exec.ExecNode, 0)
+
+		for _, node := range nodes {
+			if _, ok := rollbackResults[node.ResourceName()]; !ok {
+				savedNodes = append(savedNodes, node)
+			}
+		}
+
+		for name, err := range rollbackResults {
+			allErrors[name] = err
+		}
+	}
+
+	// state is saved with a new context, so that resources which were applied before
+	// cancellation are still recorded
+	if err := w.saveAppliedState(context.Background(), st, savedNodes, sharedDriverOpts); err != nil {
+		allErrors["state"] = fmt.Errorf("error saving state: %w", err)
+	}
+
+	// only prune orphaned resources once the resource group has been applied successfully
+	if shouldPrune && len(allErrors) == 0 {
+		for name, err := range w.prune(ctx, orphans, st, opts) {
+			allErrors[name] = err
+		}
+	}
+
+	if len(allErrors) > 0 {
+		w.runConsolidatedErrorHooks(allErrors)
+
+		return fmt.Errorf("errors were encountered with one or more resources")
+	}
+
+	// TODO: place in separate method, case on no hooks registered
+	// get all output data if there are post-apply hooks
+	allOutputData := make(map[string]interface{})
+	allOutputMask := make(map[string]interface{})
+
+	for _, resource := range group.Resources {
+		resourceOutput, resourceMask, err := drivers.GetOutput(ctx, lookupTable[resource.Name])
+		if err != nil {
+			w.runErrorHooks(err)
+			return err
+		}
+
+		allOutputData[resource.Name] = resourceOutput
+
+		if resourceMask != nil {
+			allOutputMask[resource.Name] = resourceMask
+		}
+	}
+
+	// hooks only receive sensitive values if they opt in
+	redactedOutputData := query.Redact(allOutputData, allOutputMask).(map[string]interface{})
+
+	// run any post-apply hooks
+	for _, hook := range w.hooks {
+		outputData := redactedOutputData
+
+		if includeSensitiveData(hook.WorkerHook) {
+			outputData = allOutputData
+		}
+
+		// get the data to query
+		dataQueries := hook.WorkerHook.DataQueries()
+		dataRes, err := query.PopulateQueries(dataQueries, outputData)
+		if err != nil {
+			allErrors[hook.name] = fmt.Errorf("error running DataQueries: %w", err)
+			continue
+		}
+
+		// values resolved from secrets, or copied from sensitive values into other
+		// outputs, are redacted as well
+		if !includeSensitiveData(hook.WorkerHook) {
+			dataRes = w.redactor.redactValue(dataRes).(map[string]interface{})
+		}
+
+		err = hook.WorkerHook.PostApply(dataRes)
+		if err != nil {
+			allErrors[hook.name] = fmt.Errorf("error running PostApply hook: %w", err)
 		}
+	}
+
+	if len(allErrors) > 0 {
+		w.runConsolidatedErrorHooks(allErrors)
 
 		return fmt.Errorf("errors were encountered with one or more hooks")
 	}
 
+	return nil
+}
+
+// Plan computes the changes that would be made by applying a ResourceGroup, without
+// modifying any targets. It returns a plan for each resource that could be planned.
+func (w *Worker) Plan(ctx context.Context, group *types.ResourceGroup, opts *types.ApplyOpts) (map[string]*drivers.Plan, error) {
+	resources, sharedDriverOpts, allErrors, err := w.getResources(ctx, group, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for name, err := range allErrors {
+		sharedDriverOpts.Logger.Error().Err(err).Msg(fmt.Sprintf("error constructing driver for resource %s", name))
+	}
+
+	if len(allErrors) > 0 {
+		return nil, fmt.Errorf("errors were encountered with one or more resources")
+	}
+
+	nodes, err := exec.GetExecNodes(&models.ResourceGroup{
+		APIVersion: group.Version,
+		Resources:  resources,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make(map[string]*drivers.Plan)
+	plansMu := &sync.Mutex{}
+
+	exec.Execute(ctx, nodes, getPlanExecFunc(sharedDriverOpts, plans, plansMu, w.redactor), &exec.ExecuteOpts{
+		MaxParallelism: opts.MaxParallelism,
+	})
+
+	for _, node := range nodes {
+		if node.ExecError() != nil {
+			allErrors[node.ResourceName()] = node.ExecError()
+
+			sharedDriverOpts.Logger.Error().Err(node.ExecError()).Msg(
+				fmt.Sprintf("error planning resource %s", node.ResourceName()),
+			)
+		}
+	}
+
+	if len(allErrors) > 0 {
+		return plans, fmt.Errorf("errors were encountered with one or more resources")
+	}
+
+	return plans, nil
+}
+
+// Destroy deletes every resource in a ResourceGroup. Resources are deleted in reverse
+// dependency order, so that dependents are removed before the resources they reference.
+func (w *Worker) Destroy(ctx context.Context, group *types.ResourceGroup, opts *types.ApplyOpts) error {
+	st, err := w.loadState(ctx)
+
+	if err != nil {
+		err = fmt.Errorf("error loading state: %w", err)
+		w.runErrorHooks(err)
+		return err
+	}
+
+	resources, sharedDriverOpts, allErrors, err := w.getResources(ctx, group, opts)
+
+	if err != nil {
+		w.runErrorHooks(err)
+		return err
+	} else if len(allErrors) > 0 {
+		w.runConsolidatedErrorHooks(allErrors)
+
+		return fmt.Errorf("errors were encountered with one or more resources")
+	}
+
+	nodes, err := exec.GetReverseExecNodes(&models.ResourceGroup{
+		APIVersion: group.Version,
+		Resources:  resources,
+	})
+	if err != nil {
+		w.runErrorHooks(err)
+		return err
+	}
+
+	exec.Execute(ctx, nodes, getDeleteExecFunc(sharedDriverOpts, st), &exec.ExecuteOpts{
+		MaxParallelism: opts.MaxParallelism,
+	})
+
+	for _, node := range nodes {
+		if node.ExecError() != nil {
+			allErrors[node.ResourceName()] = node.ExecError()
+		}
+	}
+
+	// state is saved with a new context, so that resources which were deleted before
+	// cancellation are still removed from it
+	if err := w.saveDeletedState(context.Background(), st, nodes); err != nil {
+		allErrors["state"] = fmt.Errorf("error saving state: %w", err)
+	}
+
+	if len(allErrors) > 0 {
+		w.runConsolidatedErrorHooks(allErrors)
+
+		return fmt.Errorf("errors were encountered with one or more resources")
+	}
+
+	return nil
+}
+
+// getResources constructs a driver for each resource in the group, and returns the
+// resources with resolved dependencies along with the options shared by each driver.
+// Secret references in each config are resolved before the driver is constructed.
+// Errors encountered while constructing drivers are returned per resource.
+func (w *Worker) getResources(
+	ctx context.Context,
+	group *types.ResourceGroup,
+	opts *types.ApplyOpts,
+) ([]*models.Resource, *drivers.SharedDriverOpts, map[string]error, error) {
+	allErrors := make(map[string]error)
+
 	// create a map of resource names to drivers
 	lookupTable := make(map[string]drivers.Driver)
-	stdOut := zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout})
+	stdOut := zerolog.New(zerolog.ConsoleWriter{Out: w.redactor.writer(os.Stdout)})
 
 	sharedDriverOpts := &drivers.SharedDriverOpts{
 		BaseDir:           opts.BasePath,
 		DriverLookupTable: &lookupTable,
 		Logger:            &stdOut,
+		CacheDir:          opts.CacheDir,
+		ChartIndexTTL:     opts.ChartIndexTTL,
 	}
 
-	execFunc := getExecFunc(sharedDriverOpts)
-
 	resources := make([]*models.Resource, 0)
 
 	for _, resource := range group.Resources {
+		// values which were decrypted when the resource group was parsed are redacted
+		// from the declared values, so that they are never written to the state
+		declared := map[string]interface{}{
+			"source": resource.Source,
+			"target": resource.Target,
+			"config": resource.Config,
+		}
+
+		declaredMask := map[string]interface{}{
+			"source": resource.SourceMask,
+			"target": resource.TargetMask,
+			"config": resource.ConfigMask,
+		}
+
+		w.redactor.add(declared, declaredMask)
+
+		redacted := query.Redact(declared, declaredMask).(map[string]interface{})
+		declaredSource, _ := redacted["source"].(map[string]interface{})
+		declaredTarget, _ := redacted["target"].(map[string]interface{})
+		declaredConfig, _ := redacted["config"].(map[string]interface{})
+
 		modelResource := &models.Resource{
-			Name:         resource.Name,
-			Driver:       resource.Driver,
-			Config:       resource.Config,
-			Source:       resource.Source,
-			Target:       resource.Target,
-			Dependencies: resource.DependsOn,
+			Name:           resource.Name,
+			Driver:         resource.Driver,
+			Config:         resource.Config,
+			DeclaredConfig: declaredConfig,
+			Source:         resource.Source,
+			DeclaredSource: declaredSource,
+			Target:         resource.Target,
+			DeclaredTarget: declaredTarget,
+			Dependencies:   resource.DependsOn,
 		}
 
 		resources = append(resources, modelResource)
 
+		decryptedHash, err := hashMaskedValues(declared, declaredMask)
+
+		if err != nil {
+			allErrors[resource.Name] = err
+			continue
+		}
+
+		modelResource.DecryptedHash = decryptedHash
+
+		config, configMask, err := w.resolveSecrets(ctx, resource.Config)
+
+		if err != nil {
+			allErrors[resource.Name] = err
+			continue
+		}
+
+		// resolved secrets and decrypted values are marked, so that they are not parsed
+		// as queries
+		modelResource.Config = config
+		modelResource.ConfigMask = query.MergeMasks(resource.ConfigMask, configMask)
+
+		if resource.Timeout != "" {
+			timeout, err := time.ParseDuration(resource.Timeout)
+
+			if err != nil {
+				allErrors[resource.Name] = fmt.Errorf("invalid timeout %s: %w", resource.Timeout, err)
+				continue
+			}
+
+			modelResource.Timeout = timeout
+		}
+
+		if resource.Wait != nil {
+			wait, err := getWait(resource.Wait)
+
+			if err != nil {
+				allErrors[resource.Name] = err
+				continue
+			}
+
+			modelResource.Wait = wait
+		}
+
 		var driver drivers.Driver
-		var err error
 
 		// switch on the driver type to construct the driver
 		if len(w.driversTable) == 0 {
-			return fmt.Errorf("no drivers registered")
+			return nil, nil, nil, fmt.Errorf("no drivers registered")
 		} else if resource.Driver == "" {
 			driver, err = w.driversTable[w.defaultDriver](modelResource, sharedDriverOpts)
 
@@ -136,112 +507,353 @@ func (w *Worker) Apply(group *types.ResourceGroup, opts *types.ApplyOpts) error
 			allErrors[resource.Name] = err
 		}
 
+		if _, ok := driver.(drivers.WaitDriver); driver != nil && modelResource.Wait != nil && !ok {
+			allErrors[resource.Name] = fmt.Errorf("driver does not support waiting for resources")
+		}
+
 		lookupTable[resource.Name] = driver
 	}
 
 	if len(allErrors) > 0 {
-		for _, hook := range w.hooks {
-			hook.OnConsolidatedErrors(allErrors)
-		}
-
-		return fmt.Errorf("errors were encountered with one or more resources")
+		return nil, sharedDriverOpts, allErrors, nil
 	}
 
 	depResolver := exec.NewDependencyResolver(resources)
 	err := depResolver.Resolve()
 	if err != nil {
-		w.runErrorHooks(err)
-		return err
+		return nil, nil, nil, err
 	}
 
-	nodes, err := exec.GetExecNodes(&models.ResourceGroup{
-		APIVersion: group.Version,
-		Resources:  resources,
-	})
+	return resources, sharedDriverOpts, allErrors, nil
+}
+
+// getWait converts a resource's wait block to its model
+func getWait(wait *types.Wait) (*models.Wait, error) {
+	res := &models.Wait{
+		Conditions: make([]*models.WaitCondition, 0),
+		Rollout:    wait.Rollout,
+		Jobs:       wait.Jobs,
+		JSONPath:   wait.JSONPath,
+		Value:      wait.Value,
+	}
+
+	for _, condition := range wait.Conditions {
+		if condition.Type == "" {
+			return nil, fmt.Errorf("wait condition type must be set")
+		}
+
+		res.Conditions = append(res.Conditions, &models.WaitCondition{
+			Kind:   condition.Kind,
+			Type:   condition.Type,
+			Status: condition.Status,
+		})
+	}
+
+	if wait.Timeout != "" {
+		timeout, err := time.ParseDuration(wait.Timeout)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid wait timeout %s: %w", wait.Timeout, err)
+		}
+
+		res.Timeout = timeout
+	}
+
+	return res, nil
+}
+
+// resolveSecrets resolves the secret references in a config, and records the resolved
+// values so that they are redacted. The returned mask marks the resolved values.
+func (w *Worker) resolveSecrets(
+	ctx context.Context,
+	config map[string]interface{},
+) (map[string]interface{}, map[string]interface{}, error) {
+	res, mask, err := w.secrets.Resolve(ctx, config)
+
 	if err != nil {
-		w.runErrorHooks(err)
-		return err
+		return nil, nil, err
 	}
 
-	exec.Execute(nodes, execFunc)
+	w.redactor.add(res, mask)
 
-	for _, node := range nodes {
-		if node.ExecError() != nil {
-			allErrors[node.ResourceName()] = node.ExecError()
+	return res, mask, nil
+}
+
+// runErrorHooks passes the error to each hook. Sensitive values are redacted from the
+// error, unless the hook opted in to receiving them.
+func (w *Worker) runErrorHooks(err error) {
+	for _, hook := range w.hooks {
+		if includeSensitiveData(hook.WorkerHook) {
+			hook.WorkerHook.OnError(err)
+		} else {
+			hook.WorkerHook.OnError(w.redactor.redactError(err))
 		}
 	}
+}
 
-	if len(allErrors) > 0 {
-		for _, hook := range w.hooks {
+// runConsolidatedErrorHooks passes the errors to each hook. Sensitive values are
+// redacted from the errors, unless the hook opted in to receiving them.
+func (w *Worker) runConsolidatedErrorHooks(allErrors map[string]error) {
+	redactedErrors := make(map[string]error)
+
+	for name, err := range allErrors {
+		redactedErrors[name] = w.redactor.redactError(err)
+	}
+
+	for _, hook := range w.hooks {
+		if includeSensitiveData(hook.WorkerHook) {
 			hook.OnConsolidatedErrors(allErrors)
+		} else {
+			hook.OnConsolidatedErrors(redactedErrors)
 		}
-
-		return fmt.Errorf("errors were encountered with one or more resources")
 	}
+}
 
-	// TODO: place in separate method, case on no hooks registered
-	// get all output data if there are post-apply hooks
-	allOutputData := make(map[string]interface{})
+// getExecFunc returns the function which applies each resource. If applied is not nil,
+// each resource is checkpointed before it is applied, and recorded once it has been
+// applied successfully. Sensitive config and output values are recorded by the redactor.
+func getExecFunc(opts *drivers.SharedDriverOpts, applied *appliedResources, redactor *redactor) exec.ExecFunc {
+	return func(ctx context.Context, resource *models.Resource) error {
+		if resource.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, resource.Timeout)
+			defer cancel()
+		}
 
-	for _, resource := range group.Resources {
-		resourceOutput, err := lookupTable[resource.Name].Output()
+		opts.Logger.Info().Msg(
+			fmt.Sprintf("running apply for resource %s", resource.Name),
+		)
+
+		lookupTable := *opts.DriverLookupTable
+		driver := lookupTable[resource.Name]
+
+		redactor.addConfig(ctx, driver, resource, lookupTable)
+
+		shouldApply := driver.ShouldApply(ctx, resource)
+
+		// record sensitive values which are known before applying, like planned outputs,
+		// so that they are redacted from the apply logs
+		redactor.addOutput(ctx, driver)
+		defer redactor.addOutput(ctx, driver)
+
+		if !shouldApply {
+			opts.Logger.Info().Msg(
+				fmt.Sprintf("resource %s unchanged", resource.Name),
+			)
+
+			return waitForResource(ctx, driver, resource, opts)
+		}
+
+		if applied != nil {
+			err := driver.(drivers.RollbackDriver).Checkpoint(ctx, resource)
+			if err != nil {
+				return fmt.Errorf("error recording previous revision: %w", err)
+			}
+		}
+
+		_, err := driver.Apply(ctx, resource)
 		if err != nil {
-			w.runErrorHooks(err)
 			return err
 		}
 
-		allOutputData[resource.Name] = resourceOutput
+		if applied != nil {
+			applied.add(resource)
+		}
+
+		opts.Logger.Info().Msg(
+			fmt.Sprintf("successfully applied resource %s", resource.Name),
+		)
+
+		return waitForResource(ctx, driver, resource, opts)
 	}
+}
+
+// waitForResource waits for the resource to become ready if it declares a wait block,
+// so that dependents only start once the resource is ready
+func waitForResource(ctx context.Context, driver drivers.Driver, resource *models.Resource, opts *drivers.SharedDriverOpts) error {
+	if resource.Wait == nil {
+		return nil
+	}
+
+	opts.Logger.Info().Msg(
+		fmt.Sprintf("waiting for resource %s to become ready", resource.Name),
+	)
+
+	err := driver.(drivers.WaitDriver).Wait(ctx, resource)
+	if err != nil {
+		return err
+	}
+
+	opts.Logger.Info().Msg(
+		fmt.Sprintf("resource %s is ready", resource.Name),
+	)
+
+	return nil
+}
+
+// getDeleteExecFunc returns the function which deletes each resource. Resources are
+// deleted with the config returned by getDeleteResource.
+func getDeleteExecFunc(opts *drivers.SharedDriverOpts, st *state.State) exec.ExecFunc {
+	return func(ctx context.Context, resource *models.Resource) error {
+		if resource.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, resource.Timeout)
+			defer cancel()
+		}
+
+		opts.Logger.Info().Msg(
+			fmt.Sprintf("running delete for resource %s", resource.Name),
+		)
+
+		lookupTable := *opts.DriverLookupTable
+
+		deleteResource, err := getDeleteResource(ctx, resource, st, lookupTable)
 
-	// run any post-apply hooks
-	for _, hook := range w.hooks {
-		// get the data to query
-		dataQueries := hook.WorkerHook.DataQueries()
-		dataRes, err := query.PopulateQueries(dataQueries, allOutputData)
 		if err != nil {
-			allErrors[hook.name] = fmt.Errorf("error running DataQueries: %w", err)
-			continue
+			return err
 		}
 
-		err = hook.WorkerHook.PostApply(dataRes)
+		_, err = lookupTable[resource.Name].Delete(ctx, deleteResource)
 		if err != nil {
-			allErrors[hook.name] = fmt.Errorf("error running PostApply hook: %w", err)
+			return err
 		}
+
+		opts.Logger.Info().Msg(
+			fmt.Sprintf("successfully deleted resource %s", resource.Name),
+		)
+
+		return nil
+	}
+}
+
+// getDeleteResource returns a copy of the resource whose config is constructed from the
+// outputs of its dependencies as they were saved in the state. Dependencies are not
+// applied before they are deleted, so drivers may not know their output. Dependencies
+// which are not in the state fall back to their live output. The copy has no
+// dependencies, so that drivers do not query the outputs again.
+func getDeleteResource(
+	ctx context.Context,
+	resource *models.Resource,
+	st *state.State,
+	lookupTable map[string]drivers.Driver,
+) (*models.Resource, error) {
+	dependencies := append([]string{}, resource.Dependencies...)
+
+	// resources which are pruned only depend on other pruned resources for ordering,
+	// but their saved config can query any resource that they depended on
+	if st != nil && st.Resources[resource.Name] != nil {
+		dependencies = append(dependencies, st.Resources[resource.Name].Dependencies...)
 	}
 
-	if len(allErrors) > 0 {
-		for _, hook := range w.hooks {
-			hook.OnConsolidatedErrors(allErrors)
+	dataMap := make(map[string]interface{})
+	dataMask := make(map[string]interface{})
+
+	for _, dep := range dependencies {
+		if _, ok := dataMap[dep]; ok {
+			continue
 		}
 
-		return fmt.Errorf("errors were encountered with one or more hooks")
+		output, outputMask, err := getDependencyOutput(ctx, dep, st, lookupTable)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if output != nil {
+			dataMap[dep] = output
+		}
+
+		if outputMask != nil {
+			dataMask[dep] = outputMask
+		}
 	}
 
-	return nil
+	config, configMask, err := query.PopulateMaskedQueries(resource.Config, resource.ConfigMask, dataMap, dataMask)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := *resource
+	res.Config = config
+	res.ConfigMask = configMask
+	res.Dependencies = nil
+
+	return &res, nil
 }
 
-func (w *Worker) runErrorHooks(err error) {
-	for _, hook := range w.hooks {
-		hook.WorkerHook.OnError(err)
+// getDependencyOutput returns the output of a dependency which was saved in the state,
+// along with the mask of its sensitive values. Sensitive values are redacted from the
+// state, so they are restored from the live output of the dependency where it is known.
+// If the dependency is not in the state, its live output is returned.
+func getDependencyOutput(
+	ctx context.Context,
+	name string,
+	st *state.State,
+	lookupTable map[string]drivers.Driver,
+) (map[string]interface{}, map[string]interface{}, error) {
+	driver := lookupTable[name]
+
+	if st == nil || st.Resources[name] == nil {
+		if driver == nil {
+			return nil, nil, nil
+		}
+
+		return drivers.GetOutput(ctx, driver)
+	}
+
+	saved := st.Resources[name]
+	redactedMask, _ := query.RedactedMask(saved.Output).(map[string]interface{})
+	outputMask := query.MergeMasks(saved.OutputMask, redactedMask)
+
+	if redactedMask == nil || driver == nil {
+		return saved.Output, outputMask, nil
 	}
+
+	// the redacted values are kept if the live output cannot be read
+	live, _, err := drivers.GetOutput(ctx, driver)
+
+	if err != nil {
+		return saved.Output, outputMask, nil
+	}
+
+	return restoreRedacted(saved.Output, live), outputMask, nil
 }
 
-func getExecFunc(opts *drivers.SharedDriverOpts) exec.ExecFunc {
-	return func(resource *models.Resource) error {
+// getPlanExecFunc returns the function which plans each resource. Sensitive values are
+// redacted from each plan's diff.
+func getPlanExecFunc(
+	opts *drivers.SharedDriverOpts,
+	plans map[string]*drivers.Plan,
+	plansMu *sync.Mutex,
+	redactor *redactor,
+) exec.ExecFunc {
+	return func(ctx context.Context, resource *models.Resource) error {
+		if resource.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, resource.Timeout)
+			defer cancel()
+		}
+
 		opts.Logger.Info().Msg(
-			fmt.Sprintf("running apply for resource %s", resource.Name),
+			fmt.Sprintf("running plan for resource %s", resource.Name),
 		)
 
 		lookupTable := *opts.DriverLookupTable
 
-		_, err := lookupTable[resource.Name].Apply(resource)
+		redactor.addConfig(ctx, lookupTable[resource.Name], resource, lookupTable)
+
+		plan, err := lookupTable[resource.Name].Plan(ctx, resource)
 		if err != nil {
 			return err
 		}
 
-		opts.Logger.Info().Msg(
-			fmt.Sprintf("successfully applied resource %s", resource.Name),
-		)
+		redactor.addOutput(ctx, lookupTable[resource.Name])
+		plan.Diff = redactor.redact(plan.Diff)
+
+		plansMu.Lock()
+		plans[resource.Name] = plan
+		plansMu.Unlock()
 
 		return nil
 	}
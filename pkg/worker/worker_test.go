@@ -0,0 +1,79 @@
+package worker_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/porter-dev/switchboard/pkg/drivers"
+	"github.com/porter-dev/switchboard/pkg/models"
+	"github.com/porter-dev/switchboard/pkg/state"
+	"github.com/porter-dev/switchboard/pkg/types"
+	"github.com/porter-dev/switchboard/pkg/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOutputDriver only knows its output once it has been applied, like the Helm driver,
+// and records the config that it is deleted with
+type fakeOutputDriver struct {
+	fakeDriver
+	output map[string]interface{}
+}
+
+func (d *fakeOutputDriver) Apply(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	d.output = map[string]interface{}{"host": "db.internal"}
+
+	return resource, nil
+}
+
+func (d *fakeOutputDriver) Delete(ctx context.Context, resource *models.Resource) (*models.Resource, error) {
+	d.events.add(fmt.Sprintf("delete %s with %v", d.name, resource.Config))
+
+	return resource, nil
+}
+
+func (d *fakeOutputDriver) Output(ctx context.Context) (map[string]interface{}, error) {
+	return d.output, nil
+}
+
+func TestDestroyReadsDependencyOutputFromState(t *testing.T) {
+	events := &fakeEvents{}
+	statePath := filepath.Join(t.TempDir(), "switchboard.state.json")
+
+	getWorker := func() *worker.Worker {
+		w := worker.NewWorker()
+		w.SetStateBackend(state.NewLocalBackend(statePath))
+		w.RegisterDriver("fake", func(resource *models.Resource, opts *drivers.SharedDriverOpts) (drivers.Driver, error) {
+			return &fakeOutputDriver{fakeDriver: fakeDriver{name: resource.Name, events: events}}, nil
+		})
+
+		return w
+	}
+
+	group := &types.ResourceGroup{
+		Version: "v1",
+		Resources: []*types.Resource{
+			{Name: "a", Driver: "fake"},
+			{
+				Name:      "b",
+				Driver:    "fake",
+				Config:    map[string]interface{}{"host": "{ .a.host }"},
+				DependsOn: []string{"a"},
+			},
+		},
+	}
+
+	err := getWorker().Apply(context.Background(), group, &types.ApplyOpts{})
+
+	assert.NoError(t, err)
+
+	// destroy runs with new drivers, which have not read their output
+	err = getWorker().Destroy(context.Background(), group, &types.ApplyOpts{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"delete b with map[host:db.internal]",
+		"delete a with map[]",
+	}, events.events)
+}
@@ -0,0 +1,64 @@
+package objutils
+
+import (
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+)
+
+// DiffText returns a unified diff between two strings. If the strings are
+// equal, an empty string is returned.
+func DiffText(from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: "live",
+		ToFile:   "desired",
+		Context:  3,
+	})
+
+	if err != nil {
+		return ""
+	}
+
+	return diff
+}
+
+// DiffYAML marshals both objects to yaml and returns a unified diff between them.
+// A nil object is treated as empty.
+func DiffYAML(from, to interface{}) (string, error) {
+	fromStr, err := toYAMLString(from)
+
+	if err != nil {
+		return "", err
+	}
+
+	toStr, err := toYAMLString(to)
+
+	if err != nil {
+		return "", err
+	}
+
+	return DiffText(fromStr, toStr), nil
+}
+
+func toYAMLString(obj interface{}) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+
+	if m, ok := obj.(map[string]interface{}); ok && m == nil {
+		return "", nil
+	}
+
+	res, err := yaml.Marshal(obj)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(res), nil
+}
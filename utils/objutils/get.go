@@ -12,6 +12,62 @@ func (e *NestedFieldNotFoundError) Error() string {
 
 // GetNestedString finds a nested string in a set of map objects. Arrays not supported.
 func GetNestedString(obj map[string]interface{}, fields ...string) (string, error) {
+	field, err := getNestedField(obj, fields...)
+
+	if err != nil {
+		return "", err
+	}
+
+	res, ok := field.(string)
+
+	if !ok {
+		return "", fmt.Errorf("%s is not a string", fields[len(fields)-1])
+	}
+
+	return res, nil
+}
+
+// GetNestedBool finds a nested boolean in a set of map objects. Arrays not supported.
+func GetNestedBool(obj map[string]interface{}, fields ...string) (bool, error) {
+	field, err := getNestedField(obj, fields...)
+
+	if err != nil {
+		return false, err
+	}
+
+	res, ok := field.(bool)
+
+	if !ok {
+		return false, fmt.Errorf("%s is not a boolean", fields[len(fields)-1])
+	}
+
+	return res, nil
+}
+
+// GetNestedInt finds a nested integer in a set of map objects. Numbers decoded from
+// JSON are accepted if they have no fractional part. Arrays not supported.
+func GetNestedInt(obj map[string]interface{}, fields ...string) (int, error) {
+	field, err := getNestedField(obj, fields...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch res := field.(type) {
+	case int:
+		return res, nil
+	case int64:
+		return int(res), nil
+	case float64:
+		if res == float64(int(res)) {
+			return int(res), nil
+		}
+	}
+
+	return 0, fmt.Errorf("%s is not an integer", fields[len(fields)-1])
+}
+
+func getNestedField(obj map[string]interface{}, fields ...string) (interface{}, error) {
 	curr := obj
 	lastIndex := len(fields) - 1
 
@@ -19,27 +75,20 @@ func GetNestedString(obj map[string]interface{}, fields ...string) (string, erro
 		objField, ok := curr[field]
 
 		if !ok {
-			return "", &NestedFieldNotFoundError{field}
+			return nil, &NestedFieldNotFoundError{field}
 		}
 
 		curr, ok = objField.(map[string]interface{})
 
 		if !ok {
-			return "", fmt.Errorf("%s is not a nested object", field)
+			return nil, fmt.Errorf("%s is not a nested object", field)
 		}
 	}
 
-	// convert the last field to a string
-	strFieldGeneric, ok := curr[fields[lastIndex]]
-
-	if !ok {
-		return "", &NestedFieldNotFoundError{fields[lastIndex]}
-	}
-
-	res, ok := strFieldGeneric.(string)
+	res, ok := curr[fields[lastIndex]]
 
 	if !ok {
-		return "", fmt.Errorf("%s is not a string", fields[lastIndex])
+		return nil, &NestedFieldNotFoundError{fields[lastIndex]}
 	}
 
 	return res, nil